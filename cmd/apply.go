@@ -1,29 +1,46 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 
 	"github.com/spf13/cobra"
 
 	"github.com/brightfame/metamorph/internal/config"
+	"github.com/brightfame/metamorph/pkg/container"
+	"github.com/brightfame/metamorph/pkg/executor"
+	"github.com/brightfame/metamorph/pkg/logging"
 	"github.com/brightfame/metamorph/pkg/pipeline"
 	"github.com/brightfame/metamorph/pkg/runner"
 )
 
 func init() {
-	applyCmd.Flags().Bool("dry-run", false, "show what would be updated without making changes")
+	applyCmd.Flags().Bool("dry-run", false, "run the steps and show the resulting diff without committing, pushing or opening change requests")
+	applyCmd.Flags().String("patch-dir", "", "directory to write a .patch file per changed repository to during a dry run")
 	applyCmd.Flags().String("manifest", "", "path to the manifest file")
 	applyCmd.Flags().StringArrayP("repo", "r", []string{}, "repository to operate on (can be specified multiple times)")
+	applyCmd.Flags().String("repos-file", "", "file with a newline-delimited list of repositories to operate on")
 	applyCmd.Flags().StringP("branch", "b", "", "branch to use for applying changes")
 	applyCmd.Flags().StringP("commit-msg", "m", "", "commit message to use for the commit")
-	applyCmd.Flags().String("gitlab-org", "", "GitLab organization to use")
+	applyCmd.Flags().Bool("strict", false, "fail on undefined template variables instead of rendering an empty string")
+	applyCmd.Flags().IntP("parallelism", "p", 1, "number of repositories to process concurrently")
+	applyCmd.Flags().String("failure-policy", "continue", "what to do when a repository fails: continue (exit zero and report the failure) or fail-fast (stop and exit non-zero)")
+	applyCmd.Flags().StringP("output", "o", "text", "output format of the results: text or json")
+	applyCmd.Flags().Bool("keep-workspace", false, "keep the cloned repositories on disk after the run for debugging")
+	applyCmd.Flags().String("container-runtime", "docker", "container runtime to run the steps with: docker or podman")
+	applyCmd.Flags().String("executor", "container", "executor of the steps that don't set one: container or local to run them on the host")
+	addPlatformFlags(applyCmd)
 }
 
 var applyCmd = &cobra.Command{
 	Use:   "apply [manifest]",
 	Short: "Apply a manifest to the specified repository",
 	Args:  cobra.ArbitraryArgs,
+	// a failed run still prints its results, so neither the usage nor the error may end up in between on stdout
+	SilenceUsage:  true,
+	SilenceErrors: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		// initialize the config
 		cfg, err := config.DefaultConfig()
@@ -31,24 +48,9 @@ var applyCmd = &cobra.Command{
 			return err
 		}
 
-		// check for the GitLab org
-		gitlabOrg, err := cmd.Flags().GetString("gitlab-org")
-		if err != nil {
-			return fmt.Errorf("error getting GitLab org: %w", err)
-		}
-		if len(gitlabOrg) > 0 {
-			cfg.Platform = "gitlab"
-			cfg.PlatformOrg = gitlabOrg
-		}
-
-		// check for GitLab CI username from GITLAB_CI_USERNAME
-		if username, ok := os.LookupEnv("GITLAB_CI_USERNAME"); ok {
-			cfg.PlatformAuthConfig.Username = username
-		}
-
-		// check for GitLab CI token from GITLAB_CI_TOKEN
-		if token, ok := os.LookupEnv("GITLAB_CI_TOKEN"); ok {
-			cfg.PlatformAuthConfig.Password = token
+		// configure the SCM platform from the flags and environment
+		if err := configurePlatform(cmd, cfg); err != nil {
+			return err
 		}
 
 		// if no manifest file is provided, then abort
@@ -57,35 +59,215 @@ var applyCmd = &cobra.Command{
 			return fmt.Errorf("no manifest file provided")
 		}
 
+		// the executor of the run decides which steps need an image, so it must be known before validating
+		executorType, err := cmd.Flags().GetString("executor")
+		if err != nil {
+			return fmt.Errorf("error getting executor: %w", err)
+		}
+		if _, err := executor.ParseType(executorType); err != nil {
+			return err
+		}
+		cfg.Executor = executorType
+
 		// load the manifest file into a pipeline
 		p, err := pipeline.LoadManifestFile(cfg, manifestFile)
 		if err != nil {
 			return err
 		}
 
-		// get the repos from the command line flags
-		repos, err := cmd.Flags().GetStringArray("repo")
+		// override the branch and commit message from the command line flags
+		branch, err := cmd.Flags().GetString("branch")
+		if err != nil {
+			return fmt.Errorf("error getting branch: %w", err)
+		}
+		if branch != "" {
+			p.SetBranchName(branch)
+		}
+
+		commitMsg, err := cmd.Flags().GetString("commit-msg")
+		if err != nil {
+			return fmt.Errorf("error getting commit message: %w", err)
+		}
+		if commitMsg != "" {
+			p.Commit.Message = commitMsg
+		}
+
+		strict, err := cmd.Flags().GetBool("strict")
+		if err != nil {
+			return fmt.Errorf("error getting strict: %w", err)
+		}
+		if strict {
+			p.Strict = true
+		}
+
+		// get the repos from the command line flags and the repos file, falling back to the repos of the manifest
+		repoNames, err := cmd.Flags().GetStringArray("repo")
 		if err != nil {
 			return fmt.Errorf("error getting repos: %w", err)
 		}
-		cfg.Repos = repos
+		repos := make([]config.Repo, 0, len(repoNames))
+		for _, name := range repoNames {
+			repos = append(repos, config.Repo{Name: name})
+		}
 
-		// create a new runner instance and execute the pipeline
-		runner := runner.New(cfg, p)
-		results, err := runner.Run(cmd.Context())
+		reposFile, err := cmd.Flags().GetString("repos-file")
+		if err != nil {
+			return fmt.Errorf("error getting repos-file: %w", err)
+		}
+		if reposFile != "" {
+			fileRepos, err := config.ReadReposFile(reposFile)
+			if err != nil {
+				return err
+			}
+			repos = append(repos, fileRepos...)
+		}
+
+		// discover the repos from the SCM platform when the manifest has a targets query
+		if len(repos) == 0 && p.Targets != nil {
+			discovered, err := discoverRepos(cmd.Context(), cfg, *p.Targets)
+			if err != nil {
+				return err
+			}
+			cfg.Logger.Infof("Discovered %d repositories", len(discovered))
+			if len(discovered) == 0 {
+				return fmt.Errorf("the targets query of the manifest did not match any repositories")
+			}
+			repos = discovered
+		}
+
+		cfg.Repos = config.MergeRepos(p.Repos, repos)
+		if len(cfg.Repos) == 0 {
+			return fmt.Errorf("no repositories to operate on, use --repo, --repos-file or the repos or targets section of the manifest")
+		}
+
+		keepWorkspace, err := cmd.Flags().GetBool("keep-workspace")
+		if err != nil {
+			return fmt.Errorf("error getting keep-workspace: %w", err)
+		}
+		cfg.KeepWorkspace = keepWorkspace
+
+		containerRuntime, err := cmd.Flags().GetString("container-runtime")
 		if err != nil {
+			return fmt.Errorf("error getting container-runtime: %w", err)
+		}
+		if _, err := container.ParseRuntimeType(containerRuntime); err != nil {
+			return err
+		}
+		cfg.ContainerRuntime = containerRuntime
+
+		parallelism, err := cmd.Flags().GetInt("parallelism")
+		if err != nil {
+			return fmt.Errorf("error getting parallelism: %w", err)
+		}
+		if parallelism < 1 {
+			return fmt.Errorf("parallelism must be at least 1, got %d", parallelism)
+		}
+		cfg.Parallelism = parallelism
+
+		failurePolicy, err := cmd.Flags().GetString("failure-policy")
+		if err != nil {
+			return fmt.Errorf("error getting failure-policy: %w", err)
+		}
+		if _, err := runner.ParseFailurePolicy(failurePolicy); err != nil {
 			return err
 		}
+		cfg.FailurePolicy = failurePolicy
+
+		dryRun, err := cmd.Flags().GetBool("dry-run")
+		if err != nil {
+			return fmt.Errorf("error getting dry-run: %w", err)
+		}
+		cfg.DryRun = dryRun
+
+		patchDir, err := cmd.Flags().GetString("patch-dir")
+		if err != nil {
+			return fmt.Errorf("error getting patch-dir: %w", err)
+		}
+		if patchDir != "" && !dryRun {
+			return fmt.Errorf("--patch-dir can only be used with --dry-run")
+		}
+		cfg.PatchDir = patchDir
+
+		output, err := cmd.Flags().GetString("output")
+		if err != nil {
+			return fmt.Errorf("error getting output: %w", err)
+		}
+		if output != "text" && output != "json" {
+			return fmt.Errorf("unknown output format %q, must be text or json", output)
+		}
+		if output == "json" {
+			// keep stdout clean for the JSON document
+			logger, err := logging.GetLogger(os.Stderr, "info", false)
+			if err != nil {
+				return err
+			}
+			cfg.Logger = logger
+		}
+
+		// create a new runner instance and execute the pipeline
+		runner := runner.New(cfg, p)
+		results, runErr := runner.Run(cmd.Context())
 
 		// print the results
-		for _, result := range results {
-			fmt.Printf("Step: %s\n", result.StepName)
-			fmt.Printf("Exit Code: %d\n", result.ExitCode)
-			fmt.Printf("Output: %s\n", string(result.Output))
-			fmt.Printf("Error: %v\n", result.Error)
-			fmt.Printf("Duration: %s\n", result.Duration)
+		if output == "json" {
+			if err := printJSONResults(cmd.OutOrStdout(), results); err != nil {
+				return err
+			}
+		} else {
+			printTextResults(cmd.OutOrStdout(), results)
 		}
 
-		return nil
+		return runErr
 	},
 }
+
+// printTextResults prints a human readable summary of the results.
+func printTextResults(w io.Writer, results []runner.RepoResult) {
+	for _, result := range results {
+		fmt.Fprintf(w, "Repo: %s\n", result.Repo)
+		fmt.Fprintf(w, "Status: %s\n", result.Status)
+		if result.Branch != "" {
+			fmt.Fprintf(w, "Branch: %s\n", result.Branch)
+			fmt.Fprintf(w, "Commit: %s\n", result.CommitSHA)
+		}
+		if result.ChangeRequestURL != "" {
+			fmt.Fprintf(w, "Change Request: %s\n", result.ChangeRequestURL)
+		}
+		for _, step := range result.Steps {
+			fmt.Fprintf(w, "  Step: %s\n", step.StepName)
+			fmt.Fprintf(w, "  Status: %s\n", step.Status)
+			if len(step.Attempts) > 1 {
+				fmt.Fprintf(w, "  Attempts: %d\n", len(step.Attempts))
+			}
+			fmt.Fprintf(w, "  Exit Code: %d\n", step.ExitCode)
+			fmt.Fprintf(w, "  Stdout: %s\n", step.Stdout)
+			fmt.Fprintf(w, "  Stderr: %s\n", step.Stderr)
+			fmt.Fprintf(w, "  Error: %v\n", step.Error)
+			fmt.Fprintf(w, "  Duration: %s\n", step.Duration)
+		}
+		if result.DiffStat != "" {
+			fmt.Fprintf(w, "Diff Stat:\n%s", result.DiffStat)
+		}
+		if result.PatchFile != "" {
+			fmt.Fprintf(w, "Patch: %s\n", result.PatchFile)
+		}
+		if result.Diff != "" {
+			fmt.Fprintf(w, "Diff:\n%s", result.Diff)
+		}
+		if result.Error != nil {
+			fmt.Fprintf(w, "Error: %v\n", result.Error)
+		}
+	}
+
+	fmt.Fprintln(w, "\nSummary:")
+	for _, result := range results {
+		fmt.Fprintf(w, "  %s: %s\n", result.Repo, result.Summary())
+	}
+}
+
+// printJSONResults prints the results as an indented JSON document.
+func printJSONResults(w io.Writer, results []runner.RepoResult) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(results)
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyErrorKeepsStdoutClean(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	rootCmd.SetOut(&stdout)
+	rootCmd.SetErr(&stderr)
+	rootCmd.SetArgs([]string{"apply", "--output", "json"})
+	t.Cleanup(func() {
+		rootCmd.SetOut(nil)
+		rootCmd.SetErr(nil)
+		rootCmd.SetArgs(nil)
+	})
+
+	err := rootCmd.Execute()
+	require.ErrorContains(t, err, "no manifest file provided")
+
+	// neither the usage nor the error are printed by cobra, main prints the error to stderr
+	require.Empty(t, stdout.String())
+	require.Empty(t, stderr.String())
+}
@@ -23,12 +23,15 @@ func init() {
 
 	// Add commands
 	rootCmd.AddCommand(applyCmd)
+	rootCmd.AddCommand(reposCmd)
+	rootCmd.AddCommand(validateCmd)
 	rootCmd.AddCommand(serveCmd)
 }
 
 func main() {
 	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
+		// keep stdout clean for machine-readable output, e.g. of validate -o json
+		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 }
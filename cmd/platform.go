@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/brightfame/metamorph/internal/config"
+	"github.com/brightfame/metamorph/pkg/scm"
+)
+
+// addPlatformFlags adds the flags that select and configure the SCM platform to the command.
+func addPlatformFlags(cmd *cobra.Command) {
+	cmd.Flags().String("gitlab-org", "", "GitLab organization to use")
+	cmd.Flags().String("github-org", "", "GitHub organization to use")
+	cmd.Flags().String("platform-url", "", "base URL of a self-hosted GitLab or GitHub Enterprise instance")
+	cmd.Flags().String("platform-api-url", "", "API URL of the SCM platform (derived from --platform-url by default)")
+	cmd.Flags().String("platform-ssh-host", "", "SSH host of the SCM platform (derived from --platform-url by default)")
+	cmd.Flags().String("clone-protocol", "", "protocol used to clone repositories: https or ssh")
+	cmd.Flags().String("ca-bundle", "", "path to a PEM file with additional CA certificates for the SCM platform")
+}
+
+// configurePlatform sets the SCM platform, org, endpoint and credentials of the config from the command line flags
+// and the environment.
+func configurePlatform(cmd *cobra.Command, cfg *config.Config) error {
+	// check for the GitLab org
+	gitlabOrg, err := cmd.Flags().GetString("gitlab-org")
+	if err != nil {
+		return fmt.Errorf("error getting GitLab org: %w", err)
+	}
+	if len(gitlabOrg) > 0 {
+		cfg.Platform = "gitlab"
+		cfg.PlatformOrg = gitlabOrg
+	}
+
+	// check for the GitHub org
+	githubOrg, err := cmd.Flags().GetString("github-org")
+	if err != nil {
+		return fmt.Errorf("error getting GitHub org: %w", err)
+	}
+	if len(githubOrg) > 0 {
+		cfg.Platform = "github"
+		cfg.PlatformOrg = githubOrg
+	}
+
+	// check for a self-hosted SCM platform
+	endpoint, err := platformEndpointFromFlags(cmd, cfg.PlatformEndpoint())
+	if err != nil {
+		return err
+	}
+	cfg.Platforms = map[string]config.PlatformEndpointConfig{cfg.Platform: endpoint}
+
+	// check for GitLab CI username from GITLAB_CI_USERNAME
+	if username, ok := os.LookupEnv("GITLAB_CI_USERNAME"); ok {
+		cfg.PlatformAuthConfig.Username = username
+	}
+
+	// check for GitLab CI token from GITLAB_CI_TOKEN
+	if token, ok := os.LookupEnv("GITLAB_CI_TOKEN"); ok {
+		cfg.PlatformAuthConfig.Password = token
+	}
+
+	// check for a GitHub token from GITHUB_TOKEN
+	if token, ok := os.LookupEnv("GITHUB_TOKEN"); ok && cfg.Platform == "github" {
+		cfg.GitHubToken = token
+		cfg.PlatformAuthConfig.Password = token
+	}
+
+	return nil
+}
+
+// platformEndpointFromFlags overrides the endpoint configuration with any values set on the command line.
+func platformEndpointFromFlags(cmd *cobra.Command, endpoint config.PlatformEndpointConfig) (config.PlatformEndpointConfig, error) {
+	flags := map[string]*string{
+		"platform-url":      &endpoint.BaseURL,
+		"platform-api-url":  &endpoint.APIURL,
+		"platform-ssh-host": &endpoint.SSHHost,
+		"clone-protocol":    &endpoint.CloneProtocol,
+		"ca-bundle":         &endpoint.CABundle,
+	}
+
+	for name, value := range flags {
+		flagValue, err := cmd.Flags().GetString(name)
+		if err != nil {
+			return endpoint, fmt.Errorf("error getting %s: %w", name, err)
+		}
+		if flagValue != "" {
+			*value = flagValue
+		}
+	}
+
+	return endpoint, nil
+}
+
+// discoverRepos lists the repositories of the configured SCM platform that match the query.
+func discoverRepos(ctx context.Context, cfg *config.Config, query config.RepoQuery) ([]config.Repo, error) {
+	pt, err := scm.ParsePlatformType(cfg.Platform)
+	if err != nil {
+		return nil, err
+	}
+
+	platform, err := scm.NewPlatform(pt, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	found, err := platform.ListRepos(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("unable to discover repositories: %w", err)
+	}
+
+	repos := make([]config.Repo, 0, len(found))
+	for _, repo := range found {
+		repos = append(repos, config.Repo{Name: repo.Name})
+	}
+	return repos, nil
+}
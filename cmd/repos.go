@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/brightfame/metamorph/internal/config"
+	"github.com/brightfame/metamorph/pkg/pipeline"
+	"github.com/brightfame/metamorph/pkg/scm"
+)
+
+func init() {
+	reposListCmd.Flags().String("manifest", "", "use the targets query of the manifest file")
+	reposListCmd.Flags().String("group", "", "group or subgroup to search, relative to the org (GitLab only)")
+	reposListCmd.Flags().Bool("include-subgroups", false, "also search the subgroups of the group (GitLab only)")
+	reposListCmd.Flags().StringArray("topic", []string{}, "only list repositories with the topic (can be specified multiple times)")
+	reposListCmd.Flags().String("visibility", "", "only list repositories with the visibility: public, internal or private")
+	reposListCmd.Flags().Bool("archived", false, "list archived instead of active repositories")
+	reposListCmd.Flags().String("language", "", "only list repositories using the language")
+	reposListCmd.Flags().String("name", "", "only list repositories whose name matches the glob")
+	reposListCmd.Flags().StringP("output", "o", "text", "output format: text (one repository per line) or json")
+	addPlatformFlags(reposListCmd)
+
+	reposCmd.AddCommand(reposListCmd)
+}
+
+var reposCmd = &cobra.Command{
+	Use:   "repos",
+	Short: "Work with the repositories of the SCM platform",
+}
+
+var reposListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the repositories matching a targets query",
+	Long: `List the repositories of the SCM platform that match a targets query. The query is read from the
+targets section of the manifest and can be refined with flags. The text output can be used as a --repos-file.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.DefaultConfig()
+		if err != nil {
+			return err
+		}
+
+		if err := configurePlatform(cmd, cfg); err != nil {
+			return err
+		}
+
+		query, err := repoQueryFromFlags(cmd, cfg)
+		if err != nil {
+			return err
+		}
+
+		output, err := cmd.Flags().GetString("output")
+		if err != nil {
+			return fmt.Errorf("error getting output: %w", err)
+		}
+		if output != "text" && output != "json" {
+			return fmt.Errorf("unknown output format %q, must be text or json", output)
+		}
+
+		pt, err := scm.ParsePlatformType(cfg.Platform)
+		if err != nil {
+			return err
+		}
+		platform, err := scm.NewPlatform(pt, cfg)
+		if err != nil {
+			return err
+		}
+
+		repos, err := platform.ListRepos(cmd.Context(), query)
+		if err != nil {
+			return fmt.Errorf("unable to list repositories: %w", err)
+		}
+
+		if output == "json" {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(repos)
+		}
+
+		for _, repo := range repos {
+			fmt.Println(repo.Name)
+		}
+		return nil
+	},
+}
+
+// repoQueryFromFlags returns the targets query of the manifest, if given, refined by any filters set on the command
+// line.
+func repoQueryFromFlags(cmd *cobra.Command, cfg *config.Config) (config.RepoQuery, error) {
+	query := config.RepoQuery{}
+
+	manifestFile, err := cmd.Flags().GetString("manifest")
+	if err != nil {
+		return query, fmt.Errorf("error getting manifest: %w", err)
+	}
+	if manifestFile != "" {
+		p, err := pipeline.LoadManifestFile(cfg, manifestFile)
+		if err != nil {
+			return query, err
+		}
+		if p.Targets != nil {
+			query = *p.Targets
+		}
+	}
+
+	flags := cmd.Flags()
+	stringFlags := map[string]*string{
+		"group":      &query.Group,
+		"visibility": &query.Visibility,
+		"language":   &query.Language,
+		"name":       &query.Name,
+	}
+	for name, value := range stringFlags {
+		if !flags.Changed(name) {
+			continue
+		}
+		if *value, err = flags.GetString(name); err != nil {
+			return query, fmt.Errorf("error getting %s: %w", name, err)
+		}
+	}
+
+	if flags.Changed("include-subgroups") {
+		if query.IncludeSubgroups, err = flags.GetBool("include-subgroups"); err != nil {
+			return query, fmt.Errorf("error getting include-subgroups: %w", err)
+		}
+	}
+	if flags.Changed("archived") {
+		archived, err := flags.GetBool("archived")
+		if err != nil {
+			return query, fmt.Errorf("error getting archived: %w", err)
+		}
+		query.Archived = &archived
+	}
+	if flags.Changed("topic") {
+		if query.Topics, err = flags.GetStringArray("topic"); err != nil {
+			return query, fmt.Errorf("error getting topic: %w", err)
+		}
+	}
+
+	return query, query.Validate()
+}
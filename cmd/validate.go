@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/brightfame/metamorph/internal/config"
+	"github.com/brightfame/metamorph/pkg/executor"
+	"github.com/brightfame/metamorph/pkg/logging"
+	"github.com/brightfame/metamorph/pkg/pipeline"
+)
+
+func init() {
+	validateCmd.Flags().String("manifest", "", "path to the manifest file")
+	validateCmd.Flags().StringP("output", "o", "text", "output format of the problems: text (file:line:column: message) or json")
+	validateCmd.Flags().Bool("print-schema", false, "print the JSON Schema of the manifest format and exit")
+	validateCmd.Flags().String("executor", "container", "executor the manifest is applied with: container or local")
+	addPlatformFlags(validateCmd)
+}
+
+var validateCmd = &cobra.Command{
+	Use:   "validate [manifest...]",
+	Short: "Check manifests for problems without running them",
+	Long: `Check manifests for unknown keys, invalid durations and volumes, duplicate step names, environment
+variables that aren't set and anything else that would stop them from loading. All the problems are reported at
+once, and the command exits non-zero if there are any, so it can be used in CI.`,
+	Args:          cobra.ArbitraryArgs,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		printSchema, err := cmd.Flags().GetBool("print-schema")
+		if err != nil {
+			return fmt.Errorf("error getting print-schema: %w", err)
+		}
+		if printSchema {
+			_, err := cmd.OutOrStdout().Write(pipeline.Schema)
+			return err
+		}
+
+		cfg, err := config.DefaultConfig()
+		if err != nil {
+			return err
+		}
+
+		// the GitLab org is substituted into manifests, so configure the platform like apply does
+		if err := configurePlatform(cmd, cfg); err != nil {
+			return err
+		}
+
+		// steps run by the local executor don't need an image, so validate against the executor of the run
+		executorType, err := cmd.Flags().GetString("executor")
+		if err != nil {
+			return fmt.Errorf("error getting executor: %w", err)
+		}
+		if _, err := executor.ParseType(executorType); err != nil {
+			return err
+		}
+		cfg.Executor = executorType
+
+		manifestFiles := args
+		manifestFile, err := cmd.Flags().GetString("manifest")
+		if err != nil {
+			return fmt.Errorf("error getting manifest: %w", err)
+		}
+		if manifestFile != "" {
+			manifestFiles = append(manifestFiles, manifestFile)
+		}
+		if len(manifestFiles) == 0 {
+			return fmt.Errorf("no manifest file provided")
+		}
+
+		output, err := cmd.Flags().GetString("output")
+		if err != nil {
+			return fmt.Errorf("error getting output: %w", err)
+		}
+		if output != "text" && output != "json" {
+			return fmt.Errorf("unknown output format %q, must be text or json", output)
+		}
+		if output == "json" {
+			// keep stdout clean for the JSON document
+			logger, err := logging.GetLogger(os.Stderr, "info", false)
+			if err != nil {
+				return err
+			}
+			cfg.Logger = logger
+		}
+
+		problems := make([]pipeline.Problem, 0)
+		for _, file := range manifestFiles {
+			found, err := pipeline.ValidateManifestFile(cfg, file)
+			if err != nil {
+				return err
+			}
+			problems = append(problems, found...)
+		}
+
+		if output == "json" {
+			enc := json.NewEncoder(cmd.OutOrStdout())
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(problems); err != nil {
+				return err
+			}
+		} else {
+			for _, problem := range problems {
+				fmt.Fprintln(cmd.OutOrStdout(), problem)
+			}
+		}
+
+		if len(problems) > 0 {
+			return fmt.Errorf("found %d problem(s)", len(problems))
+		}
+		return nil
+	},
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/brightfame/metamorph/pkg/pipeline"
+)
+
+func TestValidateJSONOutput(t *testing.T) {
+	manifest := filepath.Join(t.TempDir(), "manifest.yaml")
+	require.NoError(t, os.WriteFile(manifest, []byte(`steps:
+  - name: bump
+    imag: node:22
+    run: ./bump-node.sh
+`), 0o644))
+
+	var stdout, stderr bytes.Buffer
+	rootCmd.SetOut(&stdout)
+	rootCmd.SetErr(&stderr)
+	rootCmd.SetArgs([]string{"validate", "--output", "json", "--executor", "local", manifest})
+	t.Cleanup(func() {
+		rootCmd.SetOut(nil)
+		rootCmd.SetErr(nil)
+		rootCmd.SetArgs(nil)
+	})
+
+	err := rootCmd.Execute()
+	require.ErrorContains(t, err, "problem(s)")
+
+	// the whole of stdout is the JSON document, the summary is left to main to print to stderr
+	var problems []pipeline.Problem
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &problems), stdout.String())
+	require.NotEmpty(t, problems)
+	require.Equal(t, manifest, problems[0].File)
+	require.Equal(t, 3, problems[0].Line)
+}
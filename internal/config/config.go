@@ -1,6 +1,7 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 
@@ -19,16 +20,32 @@ type Config struct {
 	// DefaultContainerRepoPath is the path inside the container to mount the repository.
 	DefaultContainerRepoPath string
 	// Repos is a list of repositories to work with.
-	Repos []string `yaml:"repos"`
+	Repos []Repo `yaml:"repos"`
 	// Platform is the SCM platform you are working with.
 	Platform           string             `yaml:"platform,omitempty"`
 	PlatformOrg        string             `yaml:"platform_org,omitempty"`
 	PlatformAuthConfig PlatformAuthConfig `yaml:"platform_auth_config,omitempty"`
-	// ContainerRuntime is the container runtime to use.
+	// Platforms configures the endpoints of self-hosted SCM platforms, keyed by platform name.
+	Platforms map[string]PlatformEndpointConfig `yaml:"platforms,omitempty"`
+	// ContainerRuntime is the container runtime to use: docker (default) or podman.
 	ContainerRuntime string `yaml:"container_runtime,omitempty"`
+	// Executor runs the steps that don't choose one themselves: container (default) or local.
+	Executor string `yaml:"executor,omitempty"`
+	// Parallelism is the maximum number of repositories processed concurrently.
+	Parallelism int `yaml:"parallelism,omitempty"`
+	// FailurePolicy is either "continue" (default) or "fail-fast".
+	FailurePolicy string `yaml:"failure_policy,omitempty"`
+	// DryRun runs the steps and reports the resulting diff without committing, pushing or opening change requests.
+	DryRun bool `yaml:"dry_run,omitempty"`
+	// PatchDir is the directory dry runs write a .patch file per changed repository to. Patches aren't written when
+	// it is empty.
+	PatchDir string `yaml:"patch_dir,omitempty"`
+	// KeepWorkspace preserves the cloned repositories after a run, which is useful for debugging.
+	KeepWorkspace bool `yaml:"keep_workspace,omitempty"`
 
 	// Server configuration
 	ServerAddress string
+	GitHubToken   string
 
 	// Database configuration
 	DatabaseURL string
@@ -46,6 +63,40 @@ type PlatformAuthConfig struct {
 	Password string // or Token
 }
 
+// PlatformEndpointConfig is the location of a self-hosted SCM platform such as GitLab or GitHub Enterprise.
+// Empty values fall back to the public SaaS endpoints.
+type PlatformEndpointConfig struct {
+	// BaseURL is the web URL of the platform, e.g. "https://git.ourcompany.internal".
+	BaseURL string `yaml:"base_url,omitempty"`
+	// APIURL is the REST API URL. It is derived from BaseURL when empty.
+	APIURL string `yaml:"api_url,omitempty"`
+	// SSHHost is the host (and optional port) used for SSH clones. It defaults to the host of BaseURL.
+	SSHHost string `yaml:"ssh_host,omitempty"`
+	// CloneProtocol is either "https" (default) or "ssh".
+	CloneProtocol string `yaml:"clone_protocol,omitempty"`
+	// CABundle is the path to a PEM file with additional CA certificates to trust.
+	CABundle string `yaml:"ca_bundle,omitempty"`
+}
+
+// LoadCABundle reads the CA bundle file, if one is configured.
+func (c PlatformEndpointConfig) LoadCABundle() ([]byte, error) {
+	if c.CABundle == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(c.CABundle)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read CA bundle: %w", err)
+	}
+
+	return data, nil
+}
+
+// PlatformEndpoint returns the endpoint configuration of the selected platform.
+func (c *Config) PlatformEndpoint() PlatformEndpointConfig {
+	return c.Platforms[c.Platform]
+}
+
 // DefaultConfig returns the default Config. All the path values are relative
 // to the data directory.
 // Use Validate() to validate the config and ensure absolute paths.
@@ -72,6 +123,8 @@ func DefaultConfig() (*Config, error) {
 			Password: "",
 		},
 		ContainerRuntime: "docker",
+		Executor:         "container",
+		Parallelism:      1,
 		DatabaseURL:      "",
 	}, nil
 }
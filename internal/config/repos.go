@@ -0,0 +1,139 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Repo is a repository the pipeline is applied to. In YAML a repo is either the repository name, e.g.
+// "backend/es-indexer", or a mapping that also overrides settings for that repository.
+type Repo struct {
+	// Name is the name of the repository relative to the platform org.
+	Name string `yaml:"name"`
+	// BaseBranch is the branch that is cloned and targeted by the change request. It defaults to the default branch.
+	BaseBranch string `yaml:"base_branch,omitempty"`
+	// CloneURL overrides the clone URL derived from the SCM platform.
+	CloneURL string `yaml:"clone_url,omitempty"`
+	// Vars are variables specific to the repository. They override the vars of the manifest and are available to
+	// templates, if expressions and steps as environment variables.
+	Vars map[string]string `yaml:"vars,omitempty"`
+}
+
+// UnmarshalYAML decodes a repo from either a plain repository name or a mapping.
+func (r *Repo) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		r.Name = value.Value
+		return nil
+	}
+
+	type plain Repo
+	return value.Decode((*plain)(r))
+}
+
+// RepoNames returns the names of the given repos.
+func RepoNames(repos []Repo) []string {
+	names := make([]string, 0, len(repos))
+	for _, repo := range repos {
+		names = append(names, repo.Name)
+	}
+	return names
+}
+
+// ReadReposFile reads a newline-delimited list of repository names. Blank lines and comments starting with # are
+// ignored.
+func ReadReposFile(path string) ([]Repo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open repos file: %w", err)
+	}
+	defer f.Close()
+
+	repos := make([]Repo, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		repos = append(repos, Repo{Name: line})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read repos file %s: %w", path, err)
+	}
+
+	return repos, nil
+}
+
+// MergeRepos selects the repos to run against. Repos given on the command line replace the repos of the manifest,
+// but keep the overrides of any manifest entry with the same name. Duplicates are removed.
+func MergeRepos(manifest []Repo, cli []Repo) []Repo {
+	selected := manifest
+	if len(cli) > 0 {
+		overrides := make(map[string]Repo, len(manifest))
+		for _, repo := range manifest {
+			overrides[repo.Name] = repo
+		}
+
+		selected = make([]Repo, 0, len(cli))
+		for _, repo := range cli {
+			if override, ok := overrides[repo.Name]; ok {
+				repo = override
+			}
+			selected = append(selected, repo)
+		}
+	}
+
+	seen := make(map[string]bool, len(selected))
+	out := make([]Repo, 0, len(selected))
+	for _, repo := range selected {
+		if seen[repo.Name] {
+			continue
+		}
+		seen[repo.Name] = true
+		out = append(out, repo)
+	}
+	return out
+}
+
+// RepoQuery selects repositories by querying the SCM platform instead of listing them by hand.
+type RepoQuery struct {
+	// Group is the GitLab group or subgroup, relative to the platform org, to search. It defaults to the org itself.
+	// GitHub has no nested groups, so it must be empty there.
+	Group string `yaml:"group,omitempty"`
+	// IncludeSubgroups also searches the subgroups of the group. It is only supported by GitLab.
+	IncludeSubgroups bool `yaml:"include_subgroups,omitempty"`
+	// Topics only selects repositories that have every one of the topics.
+	Topics []string `yaml:"topics,omitempty"`
+	// Visibility is public, internal or private.
+	Visibility string `yaml:"visibility,omitempty"`
+	// Archived selects archived (true) or active (false) repositories. Archived repositories are excluded when unset.
+	Archived *bool `yaml:"archived,omitempty"`
+	// Language is the programming language of the repository, e.g. "Go". It is compared case-insensitively.
+	Language string `yaml:"language,omitempty"`
+	// Name is a glob matched against the repository name relative to the org, e.g. "backend/*-service".
+	Name string `yaml:"name,omitempty"`
+}
+
+// Validate checks the query is well formed.
+func (q RepoQuery) Validate() error {
+	switch q.Visibility {
+	case "", "public", "internal", "private":
+	default:
+		return fmt.Errorf("unknown visibility %q, must be public, internal or private", q.Visibility)
+	}
+	if _, err := path.Match(q.Name, ""); err != nil {
+		return fmt.Errorf("invalid name glob %q: %w", q.Name, err)
+	}
+	return nil
+}
+
+// IncludeArchived returns true when the query selects archived repositories.
+func (q RepoQuery) IncludeArchived() bool {
+	return q.Archived != nil && *q.Archived
+}
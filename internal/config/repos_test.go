@@ -0,0 +1,64 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestRepoUnmarshalYAML(t *testing.T) {
+	t.Parallel()
+
+	var out struct {
+		Repos []Repo `yaml:"repos"`
+	}
+	data := `
+repos:
+  - backend/critical-updates
+  - name: backend/es-indexer
+    base_branch: develop
+    clone_url: https://mirror.internal/backend/es-indexer.git
+    vars:
+      NODE_VERSION: "22"
+`
+	require.NoError(t, yaml.Unmarshal([]byte(data), &out))
+	require.Equal(t, []Repo{
+		{Name: "backend/critical-updates"},
+		{
+			Name:       "backend/es-indexer",
+			BaseBranch: "develop",
+			CloneURL:   "https://mirror.internal/backend/es-indexer.git",
+			Vars:       map[string]string{"NODE_VERSION": "22"},
+		},
+	}, out.Repos)
+}
+
+func TestReadReposFile(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "repos.txt")
+	data := "# backend services\nbackend/critical-updates\n\n  backend/es-indexer  # search\n"
+	require.NoError(t, os.WriteFile(path, []byte(data), 0o644))
+
+	repos, err := ReadReposFile(path)
+	require.NoError(t, err)
+	require.Equal(t, []string{"backend/critical-updates", "backend/es-indexer"}, RepoNames(repos))
+
+	_, err = ReadReposFile(filepath.Join(t.TempDir(), "missing.txt"))
+	require.ErrorContains(t, err, "unable to open repos file")
+}
+
+func TestMergeRepos(t *testing.T) {
+	t.Parallel()
+
+	manifest := []Repo{{Name: "a"}, {Name: "b", BaseBranch: "develop"}}
+
+	require.Equal(t, manifest, MergeRepos(manifest, nil))
+	require.Equal(t,
+		[]Repo{{Name: "b", BaseBranch: "develop"}, {Name: "c"}},
+		MergeRepos(manifest, []Repo{{Name: "b"}, {Name: "c"}, {Name: "b"}}),
+	)
+}
@@ -4,6 +4,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
+
+	"go.uber.org/zap"
 
 	"github.com/brightfame/metamorph/internal/config"
 )
@@ -14,6 +17,8 @@ type RuntimeType string
 const (
 	// DockerRuntimeType is the Docker runtime type.
 	DockerRuntimeType RuntimeType = "docker"
+	// PodmanRuntimeType is the Podman runtime type.
+	PodmanRuntimeType RuntimeType = "podman"
 )
 
 // String returns the runtime type string.
@@ -26,6 +31,8 @@ func ParseRuntimeType(rt string) (RuntimeType, error) {
 	switch rt {
 	case DockerRuntimeType.String():
 		return DockerRuntimeType, nil
+	case PodmanRuntimeType.String():
+		return PodmanRuntimeType, nil
 	default:
 		return "", fmt.Errorf("unknown runtime type: %s", rt)
 	}
@@ -54,15 +61,38 @@ type Runtime interface {
 	// PullImage pulls an image from the network to local storage. It returns any errors that occur.
 	PullImage(ctx context.Context, img DockerImage) error
 
-	// Run synchronously executes the command using the runtime, and returns any errors that occur.
+	// Run synchronously executes the command using the runtime, and returns the result and any errors that occur.
 	// If the command completes with a non-0 exit code, a ExitError will be returned.
-	Run(ctx context.Context, containerID string, config *Config, hostConfig *HostConfig) error
+	Run(ctx context.Context, containerID string, config *Config, hostConfig *HostConfig) (*RunResult, error)
+}
+
+// RunResult contains the outcome of running a container.
+type RunResult struct {
+	ContainerID string
+	ExitCode    int
+	Stdout      []byte
+	Stderr      []byte
+	StartedAt   time.Time
+	FinishedAt  time.Time
+}
+
+// ExitError indicates that a container exited with a non-zero exit code.
+type ExitError struct {
+	ExitCode int
+}
+
+// Error returns the error message.
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("script exited with status code %d", e.ExitCode)
 }
 
 // NewRuntime creates a new runtime instance using the specified type.
 func NewRuntime(rt RuntimeType, cfg *config.Config) (Runtime, error) {
-	if rt == DockerRuntimeType {
+	switch rt {
+	case DockerRuntimeType:
 		return NewDockerRuntime(cfg)
+	case PodmanRuntimeType:
+		return NewPodmanRuntime(cfg)
 	}
 
 	return nil, fmt.Errorf("unknown container runtime: %s", rt)
@@ -72,12 +102,15 @@ func NewRuntime(rt RuntimeType, cfg *config.Config) (Runtime, error) {
 type Config struct {
 	Image        DockerImage       // Name of the image
 	Entrypoint   []string          // Entrypoint to run when starting the container
-	Cmd          []string          // Command(s) to run when starting the container
+	Cmd          []string          // Command and arguments to run when starting the container, executed without a shell
 	Tty          bool              // Attach standard streams to a tty, including stdin if it is not closed.
 	WorkingDir   string            // Current directory (PWD) in the command will be launched
+	User         string            // User (and group) the command runs as, e.g. "1000:1000". The invoking user if empty.
 	AttachStdout bool              // Attach the standard output
 	AttachStderr bool              // Attach the standard error
 	Env          map[string]string // List of environment variables to set in the container
+	// Logger receives the container output. If nil, the runtime's default logger is used.
+	Logger *zap.SugaredLogger
 }
 
 // HostConfig the non-portable Config structure of a container that is dependent of the host we are running on.
@@ -86,8 +119,22 @@ type HostConfig struct {
 	Mounts []Mount
 }
 
+// MountType is the kind of a mount.
+type MountType string
+
+const (
+	// MountTypeBind mounts a path of the host. It is the default when no type is set.
+	MountTypeBind MountType = "bind"
+	// MountTypeVolume mounts a named volume managed by the runtime.
+	MountTypeVolume MountType = "volume"
+	// MountTypeTmpfs mounts an empty in-memory filesystem.
+	MountTypeTmpfs MountType = "tmpfs"
+)
+
 // Mount represents a mount (volume).
 type Mount struct {
-	Source string // Source specifies the name of the mount.
-	Target string // Target is the path within the container.
+	Type     MountType // Type of the mount, bind if empty.
+	Source   string    // Source specifies the name of the mount. It is empty for tmpfs mounts.
+	Target   string    // Target is the path within the container.
+	ReadOnly bool      // ReadOnly mounts the source read-only.
 }
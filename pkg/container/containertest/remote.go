@@ -0,0 +1,258 @@
+package containertest
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/stretchr/testify/require"
+
+	"github.com/brightfame/metamorph/internal/config"
+	"github.com/brightfame/metamorph/pkg/scm"
+)
+
+// Remote is a fake scm.Platform whose repositories are local bare git repositories, so that pipelines can clone and
+// push without network access. Change requests are recorded instead of being opened.
+type Remote struct {
+	dir            string
+	mutex          sync.Mutex
+	repos          map[string]bool
+	changeRequests []changeRequest
+	requests       []scm.ChangeRequestOptions
+}
+
+// changeRequest is a change request of the remote together with its repo and source branch.
+type changeRequest struct {
+	repo   string
+	branch string
+	*scm.ChangeRequest
+}
+
+// NewRemote creates a new fake remote without any repositories. The repositories are removed when the test ends.
+func NewRemote(t testing.TB) *Remote {
+	t.Helper()
+
+	return &Remote{
+		dir:   t.TempDir(),
+		repos: make(map[string]bool),
+	}
+}
+
+// AddRepo creates a bare repository for the repo, e.g. "backend/es-indexer", with a single commit on main that adds
+// the files, keyed by their path relative to the root of the repository.
+func (r *Remote) AddRepo(t testing.TB, name string, files map[string]string) {
+	t.Helper()
+
+	seedPath := t.TempDir()
+	seed, err := git.PlainInitWithOptions(seedPath, &git.PlainInitOptions{
+		InitOptions: git.InitOptions{DefaultBranch: plumbing.Main},
+	})
+	require.NoError(t, err)
+
+	wt, err := seed.Worktree()
+	require.NoError(t, err)
+	for file, content := range files {
+		path := filepath.Join(seedPath, filepath.FromSlash(file))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+		_, err = wt.Add(file)
+		require.NoError(t, err)
+	}
+	_, err = wt.Commit("Initial commit", &git.CommitOptions{
+		Author:            &object.Signature{Name: "Test", Email: "test@example.com", When: time.Now()},
+		AllowEmptyCommits: true,
+	})
+	require.NoError(t, err)
+
+	remotePath := r.CloneURL(name)
+	_, err = git.PlainInitWithOptions(remotePath, &git.PlainInitOptions{
+		Bare:        true,
+		InitOptions: git.InitOptions{DefaultBranch: plumbing.Main},
+	})
+	require.NoError(t, err)
+
+	_, err = seed.CreateRemote(&gitconfig.RemoteConfig{Name: "origin", URLs: []string{remotePath}})
+	require.NoError(t, err)
+	require.NoError(t, seed.Push(&git.PushOptions{RemoteName: "origin"}))
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.repos[name] = true
+}
+
+// AddBranch pushes a branch to the repo with a single commit on top of main by the author, e.g. "jane@example.com",
+// that adds the files.
+func (r *Remote) AddBranch(t testing.TB, repo, branch, author string, files map[string]string) {
+	t.Helper()
+
+	clonePath := t.TempDir()
+	clone, err := git.PlainClone(clonePath, false, &git.CloneOptions{URL: r.CloneURL(repo)})
+	require.NoError(t, err)
+
+	wt, err := clone.Worktree()
+	require.NoError(t, err)
+	require.NoError(t, wt.Checkout(&git.CheckoutOptions{Branch: plumbing.NewBranchReferenceName(branch), Create: true}))
+	for file, content := range files {
+		path := filepath.Join(clonePath, filepath.FromSlash(file))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+		_, err = wt.Add(file)
+		require.NoError(t, err)
+	}
+	_, err = wt.Commit("Update "+branch, &git.CommitOptions{
+		Author:            &object.Signature{Name: author, Email: author, When: time.Now()},
+		AllowEmptyCommits: true,
+	})
+	require.NoError(t, err)
+
+	ref := plumbing.NewBranchReferenceName(branch)
+	require.NoError(t, clone.Push(&git.PushOptions{
+		RemoteName: "origin",
+		RefSpecs:   []gitconfig.RefSpec{gitconfig.RefSpec(fmt.Sprintf("%s:%s", ref, ref))},
+	}))
+}
+
+// ReadFile returns the content of the file at the tip of the branch of the repo. It fails the test if the branch or
+// the file doesn't exist.
+func (r *Remote) ReadFile(t testing.TB, repo, branch, file string) string {
+	t.Helper()
+
+	commit := r.Commit(t, repo, branch)
+	f, err := commit.File(file)
+	require.NoError(t, err, "file %s on branch %s of %s", file, branch, repo)
+	content, err := f.Contents()
+	require.NoError(t, err)
+	return content
+}
+
+// Commit returns the commit at the tip of the branch of the repo. It fails the test if the branch doesn't exist.
+func (r *Remote) Commit(t testing.TB, repo, branch string) *object.Commit {
+	t.Helper()
+
+	bare, err := git.PlainOpen(r.CloneURL(repo))
+	require.NoError(t, err)
+	ref, err := bare.Reference(plumbing.NewBranchReferenceName(branch), true)
+	require.NoError(t, err, "branch %s of %s", branch, repo)
+	commit, err := bare.CommitObject(ref.Hash())
+	require.NoError(t, err)
+	return commit
+}
+
+// HasBranch returns true if the branch exists in the repo.
+func (r *Remote) HasBranch(repo, branch string) bool {
+	bare, err := git.PlainOpen(r.CloneURL(repo))
+	if err != nil {
+		return false
+	}
+	_, err = bare.Reference(plumbing.NewBranchReferenceName(branch), true)
+	return err == nil
+}
+
+// ChangeRequests returns the options of every change request created or updated so far, in order.
+func (r *Remote) ChangeRequests() []scm.ChangeRequestOptions {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return append([]scm.ChangeRequestOptions(nil), r.requests...)
+}
+
+// Type returns the GitLab platform type.
+func (r *Remote) Type() scm.PlatformType {
+	return scm.GitLabPlatformType
+}
+
+// CloneURL returns the path of the bare repository of the repo.
+func (r *Remote) CloneURL(repo string) string {
+	return filepath.Join(r.dir, filepath.FromSlash(repo)+".git")
+}
+
+// Auth returns no credentials, local repositories don't need any.
+func (r *Remote) Auth() (transport.AuthMethod, error) {
+	return nil, nil
+}
+
+// CABundle returns nil.
+func (r *Remote) CABundle() []byte {
+	return nil
+}
+
+// CreateOrUpdateChangeRequest records the change request. It returns the open change request of the source branch if
+// there is one.
+func (r *Remote) CreateOrUpdateChangeRequest(ctx context.Context, opts scm.ChangeRequestOptions) (*scm.ChangeRequest, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if !r.repos[opts.Repo] {
+		return nil, fmt.Errorf("repository %s not found", opts.Repo)
+	}
+	if !r.HasBranch(opts.Repo, opts.SourceBranch) {
+		return nil, fmt.Errorf("source branch %s of %s not found", opts.SourceBranch, opts.Repo)
+	}
+	r.requests = append(r.requests, opts)
+
+	for _, cr := range r.changeRequests {
+		if cr.repo == opts.Repo && cr.branch == opts.SourceBranch && cr.State == scm.ChangeRequestOpen {
+			return cr.ChangeRequest, nil
+		}
+	}
+
+	number := len(r.changeRequests) + 1
+	cr := &scm.ChangeRequest{
+		Number: number,
+		URL:    fmt.Sprintf("https://scm.example.com/%s/-/merge_requests/%d", opts.Repo, number),
+		State:  scm.ChangeRequestOpen,
+	}
+	r.changeRequests = append(r.changeRequests, changeRequest{repo: opts.Repo, branch: opts.SourceBranch, ChangeRequest: cr})
+	return cr, nil
+}
+
+// CloseChangeRequest marks the change request as closed.
+func (r *Remote) CloseChangeRequest(ctx context.Context, repo string, number int) error {
+	cr, err := r.GetChangeRequest(ctx, repo, number)
+	if err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	cr.State = scm.ChangeRequestClosed
+	return nil
+}
+
+// GetChangeRequest returns the change request with the number.
+func (r *Remote) GetChangeRequest(ctx context.Context, repo string, number int) (*scm.ChangeRequest, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, cr := range r.changeRequests {
+		if cr.repo == repo && cr.Number == number {
+			return cr.ChangeRequest, nil
+		}
+	}
+	return nil, fmt.Errorf("change request %d of %s not found", number, repo)
+}
+
+// ListRepos returns every repository of the remote, sorted by name. The query is ignored.
+func (r *Remote) ListRepos(ctx context.Context, query config.RepoQuery) ([]scm.Repository, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	repos := make([]scm.Repository, 0, len(r.repos))
+	for name := range r.repos {
+		repos = append(repos, scm.Repository{Name: name, DefaultBranch: plumbing.Main.Short()})
+	}
+	sort.Slice(repos, func(i, j int) bool {
+		return repos[i].Name < repos[j].Name
+	})
+	return repos, nil
+}
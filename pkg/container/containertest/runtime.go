@@ -0,0 +1,256 @@
+// Package containertest provides fakes of the container runtime and the SCM platform, so that pipelines can be run
+// end to end in tests without a container runtime or network access.
+package containertest
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brightfame/metamorph/pkg/container"
+)
+
+// Call is a container run recorded by the fake runtime.
+type Call struct {
+	ContainerID string
+	Config      container.Config
+	HostConfig  container.HostConfig
+}
+
+// Command returns the command of the container joined by spaces, e.g. "sh -c yarn install".
+func (c Call) Command() string {
+	return strings.Join(c.Config.Cmd, " ")
+}
+
+// Response scripts the outcome of a container run.
+type Response struct {
+	ExitCode int
+	Stdout   string
+	Stderr   string
+	// Files are written before the container exits, keyed by path. Relative paths are relative to the working
+	// directory of the container and variables such as $METAMORPH_OUTPUT are expanded with its environment. The paths
+	// are mapped to the host through the bind mounts of the container.
+	Files map[string]string
+	// Remove are the paths of the files removed before the container exits, resolved like the paths of Files.
+	Remove []string
+	// Delay is how long the container runs. A run that is cancelled before the delay elapsed fails with the error of
+	// the context.
+	Delay time.Duration
+	// Err is returned instead of starting the container.
+	Err error
+}
+
+// rule is a response together with the runs it applies to.
+type rule struct {
+	match    func(Call) bool
+	response Response
+}
+
+// Runtime is a scriptable container.Runtime. Runs get the response of the first rule that matches them and exit
+// successfully without output if none does. Every run, pull and build is recorded.
+type Runtime struct {
+	mutex  sync.Mutex
+	rules  []rule
+	calls  []Call
+	pulls  []string
+	builds []string
+	// images are the images that exist locally, pulling them returns container.ErrImageExists.
+	images map[string]bool
+}
+
+// NewRuntime creates a new fake runtime without any rules.
+func NewRuntime() *Runtime {
+	return &Runtime{
+		images: make(map[string]bool),
+	}
+}
+
+// On adds a rule that responds to the runs match returns true for.
+func (r *Runtime) On(match func(Call) bool, response Response) *Runtime {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.rules = append(r.rules, rule{match: match, response: response})
+	return r
+}
+
+// OnCommand adds a rule that responds to the runs whose command contains substr.
+func (r *Runtime) OnCommand(substr string, response Response) *Runtime {
+	return r.On(func(call Call) bool {
+		return strings.Contains(call.Command(), substr)
+	}, response)
+}
+
+// Calls returns the runs so far, in order.
+func (r *Runtime) Calls() []Call {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return append([]Call(nil), r.calls...)
+}
+
+// Pulls returns the images pulled so far, in order.
+func (r *Runtime) Pulls() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return append([]string(nil), r.pulls...)
+}
+
+// Builds returns the images built so far, in order.
+func (r *Runtime) Builds() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return append([]string(nil), r.builds...)
+}
+
+// Type returns the Docker runtime type.
+func (r *Runtime) Type() container.RuntimeType {
+	return container.DockerRuntimeType
+}
+
+// IsAvailable always returns nil.
+func (r *Runtime) IsAvailable() error {
+	return nil
+}
+
+// BuildImage records the build and makes the image available locally.
+func (r *Runtime) BuildImage(ctx context.Context, img container.DockerImage, contextDir string) (string, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.builds = append(r.builds, img.String())
+	r.images[img.String()] = true
+	return img.String(), nil
+}
+
+// PullImage records the pull. Pulling an image a second time returns container.ErrImageExists.
+func (r *Runtime) PullImage(ctx context.Context, img container.DockerImage) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.pulls = append(r.pulls, img.String())
+	if r.images[img.String()] {
+		return container.ErrImageExists
+	}
+	r.images[img.String()] = true
+	return nil
+}
+
+// Run records the run and applies the response of the first matching rule. Like the real runtimes, a non-zero exit
+// code results in both the RunResult and a *container.ExitError.
+func (r *Runtime) Run(ctx context.Context, containerID string, config *container.Config, hostConfig *container.HostConfig) (*container.RunResult, error) {
+	r.mutex.Lock()
+	if containerID == "" {
+		containerID = fmt.Sprintf("fake-%d", len(r.calls)+1)
+	}
+	call := Call{ContainerID: containerID, Config: *config}
+	if hostConfig != nil {
+		call.HostConfig = *hostConfig
+	}
+	r.calls = append(r.calls, call)
+	response := Response{}
+	for _, rule := range r.rules {
+		if rule.match(call) {
+			response = rule.response
+			break
+		}
+	}
+	r.mutex.Unlock()
+
+	if response.Err != nil {
+		return nil, response.Err
+	}
+
+	result := &container.RunResult{
+		ContainerID: containerID,
+		StartedAt:   time.Now(),
+	}
+
+	select {
+	case <-ctx.Done():
+		result.ExitCode = -1
+		result.FinishedAt = time.Now()
+		return result, fmt.Errorf("container '%s' was stopped: %w", containerID, ctx.Err())
+	case <-time.After(response.Delay):
+	}
+
+	if err := applyFiles(call, response); err != nil {
+		return nil, err
+	}
+
+	result.ExitCode = response.ExitCode
+	result.Stdout = []byte(response.Stdout)
+	result.Stderr = []byte(response.Stderr)
+	result.FinishedAt = time.Now()
+	if result.ExitCode != 0 {
+		return result, &container.ExitError{ExitCode: result.ExitCode}
+	}
+
+	return result, nil
+}
+
+// applyFiles writes and removes the files of the response on the host.
+func applyFiles(call Call, response Response) error {
+	for name, content := range response.Files {
+		hostPath, err := hostPath(call, name)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(hostPath), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(hostPath, []byte(content), 0o644); err != nil {
+			return err
+		}
+	}
+	for _, name := range response.Remove {
+		hostPath, err := hostPath(call, name)
+		if err != nil {
+			return err
+		}
+		if err := os.RemoveAll(hostPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hostPath maps a path inside the container to the host through the bind mount with the longest matching target.
+func hostPath(call Call, name string) (string, error) {
+	name = os.Expand(name, func(key string) string {
+		return call.Config.Env[key]
+	})
+	if !path.IsAbs(name) {
+		name = path.Join(call.Config.WorkingDir, name)
+	}
+	name = path.Clean(name)
+
+	var match *container.Mount
+	for i, mount := range call.HostConfig.Mounts {
+		if mount.Type != "" && mount.Type != container.MountTypeBind {
+			continue
+		}
+		if name != mount.Target && !strings.HasPrefix(name, strings.TrimSuffix(mount.Target, "/")+"/") {
+			continue
+		}
+		if match == nil || len(mount.Target) > len(match.Target) {
+			match = &call.HostConfig.Mounts[i]
+		}
+	}
+	if match == nil {
+		return "", fmt.Errorf("path %s isn't on a bind mount of container %s", name, call.ContainerID)
+	}
+	if match.ReadOnly {
+		return "", fmt.Errorf("path %s is on a read-only mount of container %s", name, call.ContainerID)
+	}
+
+	rel := strings.TrimPrefix(strings.TrimPrefix(name, match.Target), "/")
+	return filepath.Join(match.Source, filepath.FromSlash(rel)), nil
+}
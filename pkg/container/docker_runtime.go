@@ -9,6 +9,7 @@ import (
 	"io"
 	"os"
 	"os/exec"
+	"time"
 
 	"github.com/docker/cli/cli/command/image/build"
 	"github.com/docker/docker/api/types"
@@ -35,10 +36,15 @@ var (
 	ErrDockerRuntimeNotStarted = errors.New("docker is not running. We recommend using Docker to isolate patch commands from your OS. Please start the docker service or run MetaMorph using the --skip-container-runtime flag")
 )
 
+// ownershipFixTimeout bounds the container that hands files back to the user running metamorph.
+const ownershipFixTimeout = 5 * time.Minute
+
 // DockerRuntime represents the Docker container runtime.
 type DockerRuntime struct {
 	client *client.Client
 	cfg    *mmconfig.Config
+	// hostUser is the user (and group) in containers that owns files on the host like the user running metamorph.
+	hostUser string
 }
 
 // NewDockerRuntime creates a new instance of the Docker runtime.
@@ -48,10 +54,17 @@ func NewDockerRuntime(cfg *mmconfig.Config) (*DockerRuntime, error) {
 		return nil, err
 	}
 
+	return newDockerRuntime(cli, cfg), nil
+}
+
+// newDockerRuntime creates a runtime that talks to the Docker API through cli. Other runtimes that serve a Docker
+// compatible API, such as Podman, build on it.
+func newDockerRuntime(cli *client.Client, cfg *mmconfig.Config) *DockerRuntime {
 	return &DockerRuntime{
-		client: cli,
-		cfg:    cfg,
-	}, nil
+		client:   cli,
+		cfg:      cfg,
+		hostUser: fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid()),
+	}
 }
 
 // Type returns the Docker runtime type.
@@ -84,11 +97,6 @@ func (d *DockerRuntime) BuildImage(ctx context.Context, image DockerImage, conte
 		Tags:       []string{image.String()},
 	}
 
-	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
-	if err != nil {
-		return "", err
-	}
-
 	excludes, err := build.ReadDockerignore(contextDir)
 	if err != nil {
 		return "", fmt.Errorf("unable to read .dockerignore: '%s'", err.Error())
@@ -108,7 +116,7 @@ func (d *DockerRuntime) BuildImage(ctx context.Context, image DockerImage, conte
 		return "", fmt.Errorf("unable to compress context: '%s'", err.Error())
 	}
 
-	resp, err := cli.ImageBuild(ctx, buildContext, buildOptions)
+	resp, err := d.client.ImageBuild(ctx, buildContext, buildOptions)
 	if err != nil {
 		return "", fmt.Errorf("could not build image, got error '%s'", err.Error())
 	}
@@ -178,27 +186,109 @@ func (d *DockerRuntime) PullImage(ctx context.Context, img DockerImage) error {
 	return nil
 }
 
-// Run creates and starts a Docker container with the specified configuration.
-func (d *DockerRuntime) Run(ctx context.Context, containerID string, config *Config, hostConfig *HostConfig) error {
-	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
-	if err != nil {
-		d.cfg.Logger.Error(err)
-		return err
+// Run creates and starts a Docker container with the specified configuration and waits for it to exit. The
+// returned RunResult contains the exit code and output of the container. If the container exits with a non-zero
+// exit code, both the RunResult and an ExitError are returned.
+//
+// Containers run as the user running metamorph unless the config sets a user. When a container runs as another
+// user, e.g. root, the files in its writable bind mounts are handed back to the user running metamorph afterwards,
+// so that they can be committed and cleaned up.
+func (d *DockerRuntime) Run(ctx context.Context, containerID string, config *Config, hostConfig *HostConfig) (*RunResult, error) {
+	runConfig := d.containerConfig(config)
+	result, err := d.run(ctx, containerID, runConfig, hostConfig)
+	if result != nil {
+		d.fixOwnership(runConfig, hostConfig)
+	}
+
+	return result, err
+}
+
+// containerConfig returns the config the container is run with, which runs as the host user unless the config sets
+// a user.
+func (d *DockerRuntime) containerConfig(config *Config) *Config {
+	runConfig := *config
+	if runConfig.User == "" {
+		runConfig.User = d.hostUser
+	}
+	return &runConfig
+}
+
+// fixOwnership changes the owner of the files in the writable bind mounts of a container that ran as another user
+// to the user running metamorph. It runs chown as root in a container of the same image and only logs failures, as
+// the step itself has already run.
+func (d *DockerRuntime) fixOwnership(config *Config, hostConfig *HostConfig) {
+	mounts := d.ownershipFixMounts(config, hostConfig)
+	if len(mounts) == 0 {
+		return
 	}
 
-	// prepare commands
-	cmds := config.Cmd
-	if len(config.Cmd) > 0 {
-		cmds = append([]string{"/bin/bash", "-c"}, config.Cmd...)
+	logger := config.Logger
+	if logger == nil {
+		logger = d.cfg.Logger
 	}
 
+	targets := make([]string, 0, len(mounts))
+	for _, m := range mounts {
+		targets = append(targets, m.Target)
+	}
+	fixConfig := &Config{
+		Image:        config.Image,
+		Entrypoint:   []string{"chown"},
+		Cmd:          append([]string{"-R", d.hostUser}, targets...),
+		User:         "0:0",
+		AttachStdout: true,
+		AttachStderr: true,
+		Logger:       logger,
+	}
+
+	// the run's context may already be cancelled, e.g. when the step timed out
+	ctx, cancel := context.WithTimeout(context.Background(), ownershipFixTimeout)
+	defer cancel()
+
+	logger.Debugf("Changing the owner of the files written as %s to %s", config.User, d.hostUser)
+	if _, err := d.run(ctx, "", fixConfig, &HostConfig{Mounts: mounts}); err != nil {
+		logger.Warnf("Unable to change the owner of the files written as %s to %s: %v", config.User, d.hostUser, err)
+	}
+}
+
+// ownershipFixMounts returns the writable bind mounts whose files need a new owner after the container ran, which is
+// the case when it ran as a user other than the host user.
+func (d *DockerRuntime) ownershipFixMounts(config *Config, hostConfig *HostConfig) []Mount {
+	if hostConfig == nil || config.User == d.hostUser || (isRootUser(config.User) && isRootUser(d.hostUser)) {
+		return nil
+	}
+
+	mounts := make([]Mount, 0, len(hostConfig.Mounts))
+	for _, m := range hostConfig.Mounts {
+		if (m.Type == "" || m.Type == MountTypeBind) && !m.ReadOnly {
+			mounts = append(mounts, m)
+		}
+	}
+	return mounts
+}
+
+// isRootUser returns true if the user spec refers to the root user and group.
+func isRootUser(user string) bool {
+	switch user {
+	case "root", "0", "root:root", "0:0":
+		return true
+	default:
+		return false
+	}
+}
+
+// run creates and starts a container and waits for it to exit, see Run.
+func (d *DockerRuntime) run(ctx context.Context, containerID string, config *Config, hostConfig *HostConfig) (*RunResult, error) {
+	cli := d.client
+
 	// prepare the Docker configuration
 	dockerContainerConfig := container.Config{
 		Image:        config.Image.String(),
-		Cmd:          cmds,
+		Cmd:          config.Cmd,
 		Entrypoint:   config.Entrypoint,
 		Tty:          config.Tty,
 		WorkingDir:   config.WorkingDir,
+		User:         config.User,
 		AttachStderr: config.AttachStderr,
 		AttachStdout: config.AttachStdout,
 		Env:          collections.KeyValueStringSlice(config.Env),
@@ -207,10 +297,15 @@ func (d *DockerRuntime) Run(ctx context.Context, containerID string, config *Con
 	mounts := make([]mount.Mount, 0)
 	if hostConfig != nil {
 		for _, m := range hostConfig.Mounts {
+			mountType := mount.TypeBind
+			if m.Type != "" {
+				mountType = mount.Type(m.Type)
+			}
 			mounts = append(mounts, mount.Mount{
-				Type:   mount.TypeBind,
-				Source: m.Source,
-				Target: m.Target,
+				Type:     mountType,
+				Source:   m.Source,
+				Target:   m.Target,
+				ReadOnly: m.ReadOnly,
 			})
 		}
 	}
@@ -223,24 +318,53 @@ func (d *DockerRuntime) Run(ctx context.Context, containerID string, config *Con
 	resp, err := cli.ContainerCreate(ctx, &dockerContainerConfig, &dockerHostConfig, nil, nil, containerID)
 	if err != nil {
 		d.cfg.Logger.Error(err)
-		return err
+		return nil, err
+	}
+
+	logger := config.Logger
+	if logger == nil {
+		logger = d.cfg.Logger
+	}
+
+	// the container is removed once its logs are collected, or right away when the run is cancelled, so that no
+	// stopped containers pile up across repos and steps
+	defer d.removeContainer(cli, resp.ID, logger)
+
+	result := &RunResult{
+		ContainerID: resp.ID,
+		ExitCode:    -1,
+		StartedAt:   time.Now(),
 	}
 
 	if err := cli.ContainerStart(ctx, resp.ID, container.StartOptions{}); err != nil {
 		d.cfg.Logger.Error(err)
-		return err
+		return result, err
 	}
 
-	exitCode := -1
 	statusCh, errCh := cli.ContainerWait(ctx, resp.ID, container.WaitConditionNotRunning)
 	select {
 	case err := <-errCh:
 		if err != nil {
-			d.cfg.Logger.Error(err)
-			return fmt.Errorf("docker runtime error while waiting for container '%s' to exit: %w", resp.ID, err)
+			result.FinishedAt = time.Now()
+			if ctx.Err() != nil {
+				return result, fmt.Errorf("container '%s' was stopped: %w", resp.ID, ctx.Err())
+			}
+			logger.Error(err)
+			return result, fmt.Errorf("docker runtime error while waiting for container '%s' to exit: %w", resp.ID, err)
 		}
 	case status := <-statusCh:
-		exitCode = int(status.StatusCode)
+		result.ExitCode = int(status.StatusCode)
+	}
+	result.FinishedAt = time.Now()
+
+	// prefer the timestamps recorded by the daemon over our own
+	if info, err := cli.ContainerInspect(ctx, resp.ID); err == nil && info.State != nil {
+		if startedAt, err := time.Parse(time.RFC3339Nano, info.State.StartedAt); err == nil {
+			result.StartedAt = startedAt
+		}
+		if finishedAt, err := time.Parse(time.RFC3339Nano, info.State.FinishedAt); err == nil {
+			result.FinishedAt = finishedAt
+		}
 	}
 
 	// copy any logs from the container to the sugared logger instance
@@ -251,25 +375,38 @@ func (d *DockerRuntime) Run(ctx context.Context, containerID string, config *Con
 		Timestamps: false,
 	})
 	if err != nil {
-		return err
+		return result, err
 	}
 
 	var stdout, stderr bytes.Buffer
 	_, err = stdcopy.StdCopy(io.Writer(&stdout), io.Writer(&stderr), out)
 	if err != nil {
-		return err
+		return result, err
 	}
+	result.Stdout = stdout.Bytes()
+	result.Stderr = stderr.Bytes()
 
 	// write the contents of each buffer to the logger. Note: we deliberately write to InfoLevel as the container
 	// commands are not errors even though they may be written to stderr.
-	copyBufToLogger(stdout, d.cfg.Logger, zap.InfoLevel)
-	copyBufToLogger(stderr, d.cfg.Logger, zap.InfoLevel)
+	copyBufToLogger(stdout, logger, zap.InfoLevel)
+	copyBufToLogger(stderr, logger, zap.InfoLevel)
 
-	if exitCode != 0 {
-		return fmt.Errorf("script exited with status code %d", exitCode)
+	if result.ExitCode != 0 {
+		return result, &ExitError{ExitCode: result.ExitCode}
 	}
 
-	return nil
+	return result, nil
+}
+
+// removeContainer forcefully kills and removes the container. It uses a fresh context as the run's context is usually
+// already cancelled at this point.
+func (d *DockerRuntime) removeContainer(cli *client.Client, containerID string, logger *zap.SugaredLogger) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := cli.ContainerRemove(ctx, containerID, container.RemoveOptions{Force: true}); err != nil {
+		logger.Warnf("Unable to remove container %s: %v", containerID, err)
+	}
 }
 
 func copyBufToLogger(buf bytes.Buffer, logger *zap.SugaredLogger, level zapcore.Level) {
@@ -281,25 +418,15 @@ func copyBufToLogger(buf bytes.Buffer, logger *zap.SugaredLogger, level zapcore.
 	}
 }
 
+// findLocalImage returns true if the image is in local storage. The image is looked up by reference rather than
+// compared against the tags of the local images, as runtimes differ in how they qualify short names, e.g. Podman
+// stores node:22 as docker.io/library/node:22.
 func (dr *DockerRuntime) findLocalImage(ctx context.Context, img DockerImage) (bool, error) {
-	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
-	if err != nil {
-		return false, err
-	}
-
-	images, err := cli.ImageList(ctx, image.ListOptions{})
-	if err != nil {
-		return false, err
-	}
-
-	for _, image := range images {
-		if len(image.RepoTags) == 0 {
-			continue
-		}
-
-		if img.String() == image.RepoTags[0] {
-			return true, nil
+	if _, _, err := dr.client.ImageInspectWithRaw(ctx, img.String()); err != nil {
+		if client.IsErrNotFound(err) {
+			return false, nil
 		}
+		return false, err
 	}
-	return false, nil
+	return true, nil
 }
@@ -0,0 +1,52 @@
+package container
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOwnershipFixMounts(t *testing.T) {
+	t.Parallel()
+
+	mounts := []Mount{
+		{Source: "/tmp/metamorph-123", Target: "/repo"},
+		{Type: MountTypeBind, Source: "/tmp/metamorph-outputs-123", Target: "/metamorph/outputs"},
+		{Type: MountTypeBind, Source: "/home/ci/scripts", Target: "/scripts", ReadOnly: true},
+		{Type: MountTypeVolume, Source: "go-cache", Target: "/cache"},
+		{Type: MountTypeTmpfs, Target: "/tmp"},
+	}
+	writable := mounts[:2]
+
+	testCases := []struct {
+		name     string
+		hostUser string
+		user     string
+		expected []Mount
+	}{
+		{"Docker as the host user", "1000:1000", "1000:1000", nil},
+		{"Docker as root", "1000:1000", "root", writable},
+		{"Docker as another user", "1000:1000", "node", writable},
+		{"Docker run by root as root", "0:0", "root", nil},
+		{"Rootless Podman as root", "0:0", "0:0", nil},
+		{"Rootless Podman as another user", "0:0", "1000", writable},
+	}
+
+	for _, testCase := range testCases {
+		// The following is necessary to make sure testCase's values don't
+		// get updated due to concurrency within the scope of t.Run(..) below
+		testCase := testCase
+
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			d := &DockerRuntime{hostUser: testCase.hostUser}
+			actual := d.ownershipFixMounts(&Config{User: testCase.user}, &HostConfig{Mounts: mounts})
+			if testCase.expected == nil {
+				require.Empty(t, actual)
+			} else {
+				require.Equal(t, testCase.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/client"
+
+	mmconfig "github.com/brightfame/metamorph/internal/config"
+)
+
+var (
+	// ErrPodmanRuntimeNotAvailable indicates the Podman API socket can't be reached.
+	ErrPodmanRuntimeNotAvailable = errors.New("podman is not running. Please start the Podman API socket, e.g. with 'systemctl --user enable --now podman.socket', or set CONTAINER_HOST to its address")
+)
+
+// podmanHostEnv is the environment variable Podman uses for the address of its API service.
+const podmanHostEnv = "CONTAINER_HOST"
+
+// PodmanRuntime represents the Podman container runtime. It talks to the Docker compatible API served by the Podman
+// socket.
+//
+// When Podman runs rootless, the root user of a container is mapped to the user that runs metamorph and every other
+// container user to a subordinate UID. Steps therefore run as root in the container unless a user is configured, so
+// that the files they write into the mounted repo remain owned by the invoking user.
+type PodmanRuntime struct {
+	*DockerRuntime
+	host string
+}
+
+// NewPodmanRuntime creates a new instance of the Podman runtime. The socket is read from CONTAINER_HOST, falling back
+// to the default location of the rootless or rootful socket.
+func NewPodmanRuntime(cfg *mmconfig.Config) (*PodmanRuntime, error) {
+	rootless := os.Geteuid() != 0
+	host := podmanHost(rootless)
+
+	cli, err := client.NewClientWithOpts(client.WithHost(host), client.WithAPIVersionNegotiation())
+	if err != nil {
+		return nil, err
+	}
+
+	return newPodmanRuntime(cli, cfg, host, rootless), nil
+}
+
+// newPodmanRuntime creates a runtime that talks to the Podman API at host through cli.
+func newPodmanRuntime(cli *client.Client, cfg *mmconfig.Config, host string, rootless bool) *PodmanRuntime {
+	docker := newDockerRuntime(cli, cfg)
+	if rootless {
+		// the container's root is the invoking user on the host, so files written as root keep the user's ownership
+		docker.hostUser = "0:0"
+	}
+
+	return &PodmanRuntime{
+		DockerRuntime: docker,
+		host:          host,
+	}
+}
+
+// podmanHost returns the address of the Podman API socket.
+func podmanHost(rootless bool) string {
+	if host := os.Getenv(podmanHostEnv); host != "" {
+		return host
+	}
+	if !rootless {
+		return "unix:///run/podman/podman.sock"
+	}
+
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	if runtimeDir == "" {
+		runtimeDir = filepath.Join("/run/user", fmt.Sprint(os.Getuid()))
+	}
+	return "unix://" + filepath.Join(runtimeDir, "podman", "podman.sock")
+}
+
+// Type returns the Podman runtime type.
+func (p *PodmanRuntime) Type() RuntimeType {
+	return PodmanRuntimeType
+}
+
+// IsAvailable returns an error when the Podman API socket can't be reached.
+func (p *PodmanRuntime) IsAvailable() error {
+	if strings.HasPrefix(p.host, "unix://") {
+		if _, err := os.Stat(strings.TrimPrefix(p.host, "unix://")); err != nil {
+			return ErrPodmanRuntimeNotAvailable
+		}
+	}
+
+	if _, err := p.client.Ping(context.Background()); err != nil {
+		return fmt.Errorf("%w: %v", ErrPodmanRuntimeNotAvailable, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,52 @@
+package container
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	mmconfig "github.com/brightfame/metamorph/internal/config"
+)
+
+func TestPodmanHost(t *testing.T) {
+	t.Setenv(podmanHostEnv, "")
+	t.Setenv("XDG_RUNTIME_DIR", "/run/user/1000")
+	require.Equal(t, "unix:///run/user/1000/podman/podman.sock", podmanHost(true))
+	require.Equal(t, "unix:///run/podman/podman.sock", podmanHost(false))
+
+	t.Setenv(podmanHostEnv, "tcp://build-host:8888")
+	require.Equal(t, "tcp://build-host:8888", podmanHost(true))
+}
+
+func TestPodmanRuntimeContainerConfig(t *testing.T) {
+	t.Parallel()
+
+	config := &Config{Cmd: []string{"yarn", "install"}}
+
+	// rootless containers run as root, which maps to the invoking user on the host
+	rootless := newPodmanRuntime(nil, &mmconfig.Config{}, "unix:///run/user/1000/podman/podman.sock", true)
+	mapped := rootless.containerConfig(config)
+	require.Equal(t, "0:0", mapped.User)
+	require.Equal(t, config.Cmd, mapped.Cmd)
+	require.Empty(t, config.User)
+
+	// an explicit user is kept
+	require.Equal(t, "node", rootless.containerConfig(&Config{User: "node"}).User)
+
+	// rootful containers run as the invoking user like with Docker
+	rootful := newPodmanRuntime(nil, &mmconfig.Config{}, "unix:///run/podman/podman.sock", false)
+	require.Equal(t, fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid()), rootful.containerConfig(config).User)
+}
+
+func TestParseRuntimeType(t *testing.T) {
+	t.Parallel()
+
+	rt, err := ParseRuntimeType("podman")
+	require.NoError(t, err)
+	require.Equal(t, PodmanRuntimeType, rt)
+
+	_, err = ParseRuntimeType("containerd")
+	require.ErrorContains(t, err, "unknown runtime type: containerd")
+}
@@ -0,0 +1,143 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"go.uber.org/zap"
+
+	"github.com/brightfame/metamorph/pkg/container"
+)
+
+// ContainerExecutor runs commands in containers of a container runtime. The working directory is mounted into
+// every container at the same path, so the commands of consecutive executions work on the same files.
+type ContainerExecutor struct {
+	runtime  container.Runtime
+	repoPath string
+	logger   *zap.SugaredLogger
+	mutex    sync.Mutex
+	logs     bytes.Buffer
+}
+
+// NewContainerExecutor creates a new executor that runs commands with the runtime. The working directory is mounted
+// at repoPath inside the containers.
+func NewContainerExecutor(runtime container.Runtime, repoPath string, logger *zap.SugaredLogger) *ContainerExecutor {
+	return &ContainerExecutor{
+		runtime:  runtime,
+		repoPath: repoPath,
+		logger:   logger,
+	}
+}
+
+// Initialize does nothing, images are pulled when they are first used.
+func (e *ContainerExecutor) Initialize(ctx context.Context) error {
+	return nil
+}
+
+// Execute pulls the image if necessary and runs the command in a new container. A non-zero exit code results in an
+// *ExitError, a command that exceeds its timeout in ErrTimeout. The result is nil if the container couldn't be
+// started.
+func (e *ContainerExecutor) Execute(ctx context.Context, config ExecutionConfig) (*ExecutionResult, error) {
+	if len(config.Command) == 0 {
+		return nil, fmt.Errorf("no command to execute")
+	}
+	if config.Image == "" {
+		return nil, fmt.Errorf("no image to execute %s in", config.Command[0])
+	}
+
+	logger := config.Logger
+	if logger == nil {
+		logger = e.logger
+	}
+
+	// ensure the container image exists and pull it if necessary
+	image := container.ParseDockerImage(config.Image)
+	err := e.runtime.PullImage(ctx, image)
+	if errors.Is(err, container.ErrImageExists) {
+		logger.Debugf("Image %s already exists.", image)
+	} else if err != nil {
+		return nil, err
+	}
+
+	cConfig := &container.Config{
+		Image:        image,
+		Cmd:          config.Command,
+		Tty:          false,
+		WorkingDir:   e.repoPath,
+		User:         config.User,
+		AttachStdout: true,
+		AttachStderr: true,
+		Env:          config.Environment,
+		Logger:       logger,
+	}
+
+	// explicitly add a mount for the shared working directory
+	mounts := make([]container.Mount, 0, len(config.Mounts)+1)
+	mounts = append(mounts, config.Mounts...)
+	if config.WorkDir != "" {
+		mounts = append(mounts, container.Mount{
+			Source: config.WorkDir,
+			Target: e.repoPath,
+		})
+	}
+	hostConfig := &container.HostConfig{
+		Mounts: mounts,
+	}
+
+	// bound the container run by the timeout
+	runCtx := ctx
+	if config.Timeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, config.Timeout)
+		defer cancel()
+	}
+
+	runResult, err := e.runtime.Run(runCtx, "", cConfig, hostConfig)
+	if runResult == nil {
+		return nil, err
+	}
+
+	e.mutex.Lock()
+	e.logs.Write(runResult.Stdout)
+	e.logs.Write(runResult.Stderr)
+	e.mutex.Unlock()
+
+	result := &ExecutionResult{
+		ExitCode:    runResult.ExitCode,
+		Stdout:      string(runResult.Stdout),
+		Stderr:      string(runResult.Stderr),
+		ContainerID: runResult.ContainerID,
+		StartedAt:   runResult.StartedAt,
+		FinishedAt:  runResult.FinishedAt,
+	}
+
+	var exitErr *container.ExitError
+	switch {
+	case err == nil:
+	case ctx.Err() == nil && errors.Is(runCtx.Err(), context.DeadlineExceeded):
+		result.Error = fmt.Errorf("%w after %s", ErrTimeout, config.Timeout)
+	case errors.As(err, &exitErr):
+		result.Error = &ExitError{ExitCode: exitErr.ExitCode}
+	default:
+		result.Error = err
+	}
+
+	return result, result.Error
+}
+
+// Cleanup does nothing, the runtime removes containers that are stopped early.
+func (e *ContainerExecutor) Cleanup(ctx context.Context) error {
+	return nil
+}
+
+// GetLogs returns the output of the containers run so far.
+func (e *ContainerExecutor) GetLogs(ctx context.Context) (io.Reader, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return bytes.NewReader(bytes.Clone(e.logs.Bytes())), nil
+}
@@ -0,0 +1,80 @@
+package executor
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/brightfame/metamorph/pkg/container"
+	"github.com/brightfame/metamorph/pkg/container/containertest"
+)
+
+func TestContainerExecutor(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	cacheDir := t.TempDir()
+	runtime := containertest.NewRuntime().
+		OnCommand("yarn install", containertest.Response{
+			Stdout: "done\n",
+			Files: map[string]string{
+				"yarn.lock":      "# yarn lockfile v1\n",
+				"/cache/.marker": "cached\n",
+			},
+		}).
+		OnCommand("yarn lint", containertest.Response{ExitCode: 3, Stderr: "lint errors\n"}).
+		OnCommand("sleep", containertest.Response{Delay: time.Minute})
+
+	e := NewContainerExecutor(runtime, "/repo", zap.NewNop().Sugar())
+	require.NoError(t, e.Initialize(context.Background()))
+
+	result, err := e.Execute(context.Background(), ExecutionConfig{
+		WorkDir:     dir,
+		Image:       "node:22",
+		Command:     []string{"yarn", "install"},
+		Environment: map[string]string{"CI": "true"},
+		Mounts:      []container.Mount{{Source: cacheDir, Target: "/cache"}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "done\n", result.Stdout)
+	require.Equal(t, "fake-1", result.ContainerID)
+
+	// the files written in the container end up in the working directory and the mounts
+	content, err := os.ReadFile(filepath.Join(dir, "yarn.lock"))
+	require.NoError(t, err)
+	require.Equal(t, "# yarn lockfile v1\n", string(content))
+	require.FileExists(t, filepath.Join(cacheDir, ".marker"))
+
+	call := runtime.Calls()[0]
+	require.Equal(t, "/repo", call.Config.WorkingDir)
+	require.Equal(t, map[string]string{"CI": "true"}, call.Config.Env)
+	require.Equal(t, []container.Mount{
+		{Source: cacheDir, Target: "/cache"},
+		{Source: dir, Target: "/repo"},
+	}, call.HostConfig.Mounts)
+
+	// pulling an image that already exists locally is not an error
+	_, err = e.Execute(context.Background(), ExecutionConfig{WorkDir: dir, Image: "node:22", User: "root", Command: []string{"yarn", "lint"}})
+	var exitErr *ExitError
+	require.ErrorAs(t, err, &exitErr)
+	require.Equal(t, 3, exitErr.ExitCode)
+	require.Equal(t, []string{"node:22", "node:22"}, runtime.Pulls())
+	require.Empty(t, runtime.Calls()[0].Config.User)
+	require.Equal(t, "root", runtime.Calls()[1].Config.User)
+
+	result, err = e.Execute(context.Background(), ExecutionConfig{WorkDir: dir, Image: "alpine", Command: []string{"sleep", "60"}, Timeout: 200 * time.Millisecond})
+	require.ErrorIs(t, err, ErrTimeout)
+	require.Equal(t, -1, result.ExitCode)
+
+	logs, err := e.GetLogs(context.Background())
+	require.NoError(t, err)
+	data, err := io.ReadAll(logs)
+	require.NoError(t, err)
+	require.Equal(t, "done\nlint errors\n", string(data))
+}
@@ -2,15 +2,60 @@ package executor
 
 import (
 	"context"
+	"fmt"
 	"io"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/brightfame/metamorph/pkg/container"
 )
 
+// Type is the type of executor.
+type Type string
+
+const (
+	// ContainerType runs commands in a container of the configured container runtime.
+	ContainerType Type = "container"
+	// LocalType runs commands as processes on the host.
+	LocalType Type = "local"
+)
+
+// String returns the executor type string.
+func (t Type) String() string {
+	return string(t)
+}
+
+// ParseType parses the given string into a Type.
+func ParseType(t string) (Type, error) {
+	switch t {
+	case ContainerType.String():
+		return ContainerType, nil
+	case LocalType.String():
+		return LocalType, nil
+	default:
+		return "", fmt.Errorf("unknown executor type %q, must be %s or %s", t, ContainerType, LocalType)
+	}
+}
+
 // ExecutionConfig holds the common configuration for any executor
 type ExecutionConfig struct {
+	// WorkDir is the directory on the host the command works on. Container executors mount it into the container and
+	// run the command in the mount.
 	WorkDir     string
 	Environment map[string]string
 	Command     []string
-	Timeout     int
+	// Timeout is the maximum duration the command may run. Zero means no timeout.
+	Timeout time.Duration
+	// Image is the container image to run the command in. Executors that don't use containers ignore it.
+	Image string
+	// User is the user (and group) the container runs as, the user running metamorph if empty. Executors that don't
+	// use containers ignore it.
+	User string
+	// Mounts are additional volumes mounted into the container. Executors that don't use containers ignore them.
+	Mounts []container.Mount
+	// Logger receives the output of the command. If nil, the executor's logger is used.
+	Logger *zap.SugaredLogger
 }
 
 // ExecutionResult represents the output of an execution
@@ -19,6 +64,20 @@ type ExecutionResult struct {
 	Stdout   string
 	Stderr   string
 	Error    error
+	// ContainerID is the ID of the container the command ran in, if any.
+	ContainerID string
+	StartedAt   time.Time
+	FinishedAt  time.Time
+}
+
+// ExitError indicates that a command exited with a non-zero exit code.
+type ExitError struct {
+	ExitCode int
+}
+
+// Error returns the error message.
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("command exited with status code %d", e.ExitCode)
 }
 
 // Executor defines the interface for different execution environments
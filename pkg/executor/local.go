@@ -0,0 +1,117 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/brightfame/metamorph/pkg/shell"
+)
+
+// ErrTimeout indicates a command exceeded its timeout.
+var ErrTimeout = errors.New("command timed out")
+
+// LocalExecutor runs commands as processes on the host, without a container. The commands inherit the environment
+// of metamorph, so tools such as sed and jq are found on the PATH of the host.
+type LocalExecutor struct {
+	logger *zap.SugaredLogger
+	mutex  sync.Mutex
+	logs   bytes.Buffer
+}
+
+// NewLocalExecutor creates a new executor that runs commands on the host and logs their output to logger.
+func NewLocalExecutor(logger *zap.SugaredLogger) *LocalExecutor {
+	return &LocalExecutor{
+		logger: logger,
+	}
+}
+
+// Initialize does nothing, the host needs no set up.
+func (e *LocalExecutor) Initialize(ctx context.Context) error {
+	return nil
+}
+
+// Execute runs the command in the working directory and returns its output and exit code. A non-zero exit code
+// results in an *ExitError, a command that exceeds its timeout in ErrTimeout.
+func (e *LocalExecutor) Execute(ctx context.Context, config ExecutionConfig) (*ExecutionResult, error) {
+	if len(config.Command) == 0 {
+		return nil, fmt.Errorf("no command to execute")
+	}
+	if config.WorkDir == "" {
+		return nil, fmt.Errorf("no working directory to execute %s in", config.Command[0])
+	}
+
+	runCtx := ctx
+	if config.Timeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, config.Timeout)
+		defer cancel()
+	}
+
+	logger := config.Logger
+	if logger == nil {
+		logger = e.logger
+	}
+
+	options := &shell.ShellOptions{
+		NonInteractive: true,
+		Logger:         logger,
+		WorkingDir:     config.WorkDir,
+		Env:            config.Environment,
+	}
+	startedAt := time.Now()
+	output, err := shell.RunShellCommandContext(runCtx, options, config.Command[0], config.Command[1:]...)
+	finishedAt := time.Now()
+	if output == nil {
+		// the command didn't start, e.g. because it doesn't exist or the working directory is missing
+		result := &ExecutionResult{ExitCode: -1, Error: err, StartedAt: startedAt, FinishedAt: finishedAt}
+		return result, err
+	}
+
+	e.mutex.Lock()
+	e.logs.WriteString(output.Combined())
+	e.mutex.Unlock()
+
+	result := &ExecutionResult{
+		Stdout:     output.Stdout(),
+		Stderr:     output.Stderr(),
+		StartedAt:  startedAt,
+		FinishedAt: finishedAt,
+	}
+
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+	case ctx.Err() == nil && errors.Is(runCtx.Err(), context.DeadlineExceeded):
+		result.ExitCode = -1
+		result.Error = fmt.Errorf("%w after %s", ErrTimeout, config.Timeout)
+	case errors.As(err, &exitErr):
+		result.ExitCode = exitErr.ExitCode()
+		result.Error = &ExitError{ExitCode: result.ExitCode}
+	default:
+		result.ExitCode = -1
+		result.Error = err
+	}
+
+	return result, result.Error
+}
+
+// Cleanup does nothing, the commands leave their changes in the working directory.
+func (e *LocalExecutor) Cleanup(ctx context.Context) error {
+	return nil
+}
+
+// GetLogs returns the combined output of the commands executed so far.
+func (e *LocalExecutor) GetLogs(ctx context.Context) (io.Reader, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return bytes.NewReader(bytes.Clone(e.logs.Bytes())), nil
+}
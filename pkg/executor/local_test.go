@@ -0,0 +1,108 @@
+package executor
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestLocalExecutor(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	e := NewLocalExecutor(zap.NewNop().Sugar())
+	require.NoError(t, e.Initialize(context.Background()))
+
+	result, err := e.Execute(context.Background(), ExecutionConfig{
+		WorkDir:     dir,
+		Environment: map[string]string{"GREETING": "hello"},
+		Command:     []string{"/bin/sh", "-e", "-c", `echo "$GREETING" > greeting.txt && echo done && echo oops >&2`},
+	})
+	require.NoError(t, err)
+	require.Equal(t, 0, result.ExitCode)
+	require.Equal(t, "done\n", result.Stdout)
+	require.Equal(t, "oops\n", result.Stderr)
+
+	// the command ran in the working directory
+	content, err := os.ReadFile(filepath.Join(dir, "greeting.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "hello\n", string(content))
+
+	result, err = e.Execute(context.Background(), ExecutionConfig{
+		WorkDir: dir,
+		Command: []string{"/bin/sh", "-c", "echo failing; exit 3"},
+	})
+	var exitErr *ExitError
+	require.ErrorAs(t, err, &exitErr)
+	require.Equal(t, 3, exitErr.ExitCode)
+	require.Equal(t, 3, result.ExitCode)
+	require.Equal(t, "failing\n", result.Stdout)
+
+	logs, err := e.GetLogs(context.Background())
+	require.NoError(t, err)
+	all, err := io.ReadAll(logs)
+	require.NoError(t, err)
+	require.Contains(t, string(all), "done\n")
+	require.Contains(t, string(all), "failing\n")
+
+	require.NoError(t, e.Cleanup(context.Background()))
+}
+
+func TestLocalExecutorTimeout(t *testing.T) {
+	t.Parallel()
+
+	e := NewLocalExecutor(zap.NewNop().Sugar())
+	result, err := e.Execute(context.Background(), ExecutionConfig{
+		WorkDir: t.TempDir(),
+		Command: []string{"/bin/sh", "-c", "sleep 30"},
+		Timeout: 200 * time.Millisecond,
+	})
+	require.ErrorIs(t, err, ErrTimeout)
+	require.Equal(t, -1, result.ExitCode)
+}
+
+func TestLocalExecutorErrors(t *testing.T) {
+	t.Parallel()
+
+	e := NewLocalExecutor(zap.NewNop().Sugar())
+
+	_, err := e.Execute(context.Background(), ExecutionConfig{WorkDir: t.TempDir()})
+	require.ErrorContains(t, err, "no command to execute")
+
+	_, err = e.Execute(context.Background(), ExecutionConfig{Command: []string{"true"}})
+	require.ErrorContains(t, err, "no working directory")
+
+	result, err := e.Execute(context.Background(), ExecutionConfig{
+		WorkDir: t.TempDir(),
+		Command: []string{"metamorph-command-that-does-not-exist"},
+	})
+	require.ErrorIs(t, err, exec.ErrNotFound)
+	require.Equal(t, -1, result.ExitCode)
+	require.Equal(t, err, result.Error)
+
+	result, err = e.Execute(context.Background(), ExecutionConfig{
+		WorkDir: filepath.Join(t.TempDir(), "missing"),
+		Command: []string{"true"},
+	})
+	require.Error(t, err)
+	require.Equal(t, -1, result.ExitCode)
+	require.Empty(t, result.Stdout)
+}
+
+func TestParseType(t *testing.T) {
+	t.Parallel()
+
+	et, err := ParseType("local")
+	require.NoError(t, err)
+	require.Equal(t, LocalType, et)
+
+	_, err = ParseType("ssh")
+	require.ErrorContains(t, err, `unknown executor type "ssh", must be container or local`)
+}
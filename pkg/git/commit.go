@@ -0,0 +1,207 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+)
+
+// DefaultRemoteName is the name of the remote created when cloning a repository.
+const DefaultRemoteName = git.DefaultRemoteName
+
+type CommitOptions struct {
+	Message     string
+	AuthorName  string
+	AuthorEmail string
+}
+
+type PushOptions struct {
+	RemoteName string
+	Branch     string
+	Auth       transport.AuthMethod
+	CABundle   []byte
+	Force      bool
+}
+
+type FetchOptions struct {
+	RemoteName string
+	Branch     string
+	Auth       transport.AuthMethod
+	CABundle   []byte
+}
+
+// HasChanges returns true if the worktree at repoPath has any uncommitted changes, including untracked files.
+func HasChanges(repoPath string) (bool, error) {
+	repo, err := git.PlainOpen(repoPath)
+	if err != nil {
+		return false, fmt.Errorf("failed to open local repo: %w", err)
+	}
+
+	wt, err := repo.Worktree()
+	if err != nil {
+		return false, fmt.Errorf("failed to get worktree: %w", err)
+	}
+
+	status, err := wt.Status()
+	if err != nil {
+		return false, fmt.Errorf("failed to get worktree status: %w", err)
+	}
+
+	return !status.IsClean(), nil
+}
+
+// CheckoutNewBranch creates the given branch from HEAD and checks it out, keeping any changes in the worktree.
+func CheckoutNewBranch(repoPath string, branch string) error {
+	repo, err := git.PlainOpen(repoPath)
+	if err != nil {
+		return fmt.Errorf("failed to open local repo: %w", err)
+	}
+
+	wt, err := repo.Worktree()
+	if err != nil {
+		return fmt.Errorf("failed to get worktree: %w", err)
+	}
+
+	err = wt.Checkout(&git.CheckoutOptions{
+		Branch: plumbing.NewBranchReferenceName(branch),
+		Create: true,
+		Keep:   true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to checkout branch %s: %w", branch, err)
+	}
+
+	return nil
+}
+
+// CommitAll stages every change in the worktree, including untracked and deleted files, and commits them.
+// It returns the hash of the new commit.
+func CommitAll(repoPath string, opts CommitOptions) (string, error) {
+	repo, err := git.PlainOpen(repoPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open local repo: %w", err)
+	}
+
+	wt, err := repo.Worktree()
+	if err != nil {
+		return "", fmt.Errorf("failed to get worktree: %w", err)
+	}
+
+	if err := wt.AddWithOptions(&git.AddOptions{All: true}); err != nil {
+		return "", fmt.Errorf("failed to stage changes: %w", err)
+	}
+
+	hash, err := wt.Commit(opts.Message, &git.CommitOptions{
+		Author: &object.Signature{
+			Name:  opts.AuthorName,
+			Email: opts.AuthorEmail,
+			When:  time.Now(),
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to commit changes: %w", err)
+	}
+
+	return hash.String(), nil
+}
+
+// Push pushes the given branch to the remote. An up-to-date remote is not treated as an error.
+func Push(ctx context.Context, repoPath string, opts PushOptions) error {
+	repo, err := git.PlainOpen(repoPath)
+	if err != nil {
+		return fmt.Errorf("failed to open local repo: %w", err)
+	}
+
+	remoteName := opts.RemoteName
+	if remoteName == "" {
+		remoteName = DefaultRemoteName
+	}
+
+	ref := plumbing.NewBranchReferenceName(opts.Branch)
+	err = repo.PushContext(ctx, &git.PushOptions{
+		RemoteName: remoteName,
+		RefSpecs:   []config.RefSpec{config.RefSpec(fmt.Sprintf("%s:%s", ref, ref))},
+		Auth:       opts.Auth,
+		CABundle:   opts.CABundle,
+		Force:      opts.Force,
+	})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return fmt.Errorf("failed to push branch %s: %w", opts.Branch, err)
+	}
+
+	return nil
+}
+
+// RemoteBranchAuthors fetches the given branch from the remote and returns the email addresses of the authors of its
+// commits that aren't reachable from HEAD, in the order they were walked. A branch that doesn't exist on the remote
+// has no authors.
+func RemoteBranchAuthors(ctx context.Context, repoPath string, opts FetchOptions) ([]string, error) {
+	repo, err := git.PlainOpen(repoPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open local repo: %w", err)
+	}
+
+	remoteName := opts.RemoteName
+	if remoteName == "" {
+		remoteName = DefaultRemoteName
+	}
+
+	remoteRef := plumbing.NewRemoteReferenceName(remoteName, opts.Branch)
+	err = repo.FetchContext(ctx, &git.FetchOptions{
+		RemoteName: remoteName,
+		RefSpecs:   []config.RefSpec{config.RefSpec(fmt.Sprintf("+%s:%s", plumbing.NewBranchReferenceName(opts.Branch), remoteRef))},
+		Auth:       opts.Auth,
+		CABundle:   opts.CABundle,
+	})
+	if errors.Is(err, git.NoMatchingRefSpecError{}) {
+		return nil, nil
+	}
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return nil, fmt.Errorf("failed to fetch branch %s: %w", opts.Branch, err)
+	}
+
+	ref, err := repo.Reference(remoteRef, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve branch %s: %w", opts.Branch, err)
+	}
+	tip, err := repo.CommitObject(ref.Hash())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tip of branch %s: %w", opts.Branch, err)
+	}
+
+	headRef, err := repo.Head()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get HEAD: %w", err)
+	}
+	head, err := repo.CommitObject(headRef.Hash())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get HEAD commit: %w", err)
+	}
+
+	bases, err := tip.MergeBase(head)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find merge base of branch %s: %w", opts.Branch, err)
+	}
+	ignore := make([]plumbing.Hash, 0, len(bases))
+	for _, base := range bases {
+		ignore = append(ignore, base.Hash)
+	}
+
+	var authors []string
+	err = object.NewCommitPreorderIter(tip, nil, ignore).ForEach(func(commit *object.Commit) error {
+		authors = append(authors, commit.Author.Email)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk branch %s: %w", opts.Branch, err)
+	}
+
+	return authors, nil
+}
@@ -0,0 +1,129 @@
+package git
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommitAndPush(t *testing.T) {
+	t.Parallel()
+
+	remote := newTestRemote(t)
+	dest := t.TempDir()
+	require.NoError(t, Clone(CloneOptions{URL: remote, Destination: dest}))
+
+	branch, err := CurrentBranch(dest)
+	require.NoError(t, err)
+	require.Equal(t, "main", branch)
+
+	dirty, err := HasChanges(dest)
+	require.NoError(t, err)
+	require.False(t, dirty)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dest, "new.txt"), []byte("hello\n"), 0o644))
+	require.NoError(t, os.Remove(filepath.Join(dest, "README.md")))
+
+	dirty, err = HasChanges(dest)
+	require.NoError(t, err)
+	require.True(t, dirty)
+
+	require.NoError(t, CheckoutNewBranch(dest, "feature"))
+	branch, err = CurrentBranch(dest)
+	require.NoError(t, err)
+	require.Equal(t, "feature", branch)
+
+	hash, err := CommitAll(dest, CommitOptions{
+		Message:     "Add new.txt",
+		AuthorName:  "Test",
+		AuthorEmail: "test@example.com",
+	})
+	require.NoError(t, err)
+
+	dirty, err = HasChanges(dest)
+	require.NoError(t, err)
+	require.False(t, dirty)
+
+	require.NoError(t, Push(context.Background(), dest, PushOptions{Branch: "feature", Force: true}))
+
+	bare, err := git.PlainOpen(remote)
+	require.NoError(t, err)
+	ref, err := bare.Reference(plumbing.NewBranchReferenceName("feature"), true)
+	require.NoError(t, err)
+	require.Equal(t, hash, ref.Hash().String())
+
+	commit, err := bare.CommitObject(ref.Hash())
+	require.NoError(t, err)
+	require.Equal(t, "Add new.txt", commit.Message)
+	require.Equal(t, "test@example.com", commit.Author.Email)
+
+	// pushing again without new commits is not an error
+	require.NoError(t, Push(context.Background(), dest, PushOptions{Branch: "feature", Force: true}))
+}
+
+func TestRemoteBranchAuthors(t *testing.T) {
+	t.Parallel()
+
+	remote := newTestRemote(t)
+	other := t.TempDir()
+	require.NoError(t, Clone(CloneOptions{URL: remote, Destination: other}))
+	require.NoError(t, CheckoutNewBranch(other, "feature"))
+	require.NoError(t, os.WriteFile(filepath.Join(other, "new.txt"), []byte("hello\n"), 0o644))
+	_, err := CommitAll(other, CommitOptions{Message: "Add new.txt", AuthorName: "Jane", AuthorEmail: "jane@example.com"})
+	require.NoError(t, err)
+	require.NoError(t, Push(context.Background(), other, PushOptions{Branch: "feature"}))
+
+	dest := t.TempDir()
+	require.NoError(t, Clone(CloneOptions{URL: remote, Destination: dest}))
+
+	// commits shared with HEAD, like the initial commit, don't count
+	authors, err := RemoteBranchAuthors(context.Background(), dest, FetchOptions{Branch: "feature"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"jane@example.com"}, authors)
+
+	authors, err = RemoteBranchAuthors(context.Background(), dest, FetchOptions{Branch: "missing"})
+	require.NoError(t, err)
+	require.Empty(t, authors)
+}
+
+// newTestRemote creates a bare repository with a single commit on main and returns its path.
+func newTestRemote(t *testing.T) string {
+	t.Helper()
+
+	seedPath := t.TempDir()
+	seed, err := git.PlainInitWithOptions(seedPath, &git.PlainInitOptions{
+		InitOptions: git.InitOptions{DefaultBranch: plumbing.Main},
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(filepath.Join(seedPath, "README.md"), []byte("# test\n"), 0o644))
+	wt, err := seed.Worktree()
+	require.NoError(t, err)
+	_, err = wt.Add("README.md")
+	require.NoError(t, err)
+	_, err = wt.Commit("Initial commit", &git.CommitOptions{
+		Author: &object.Signature{Name: "Test", Email: "test@example.com", When: time.Now()},
+	})
+	require.NoError(t, err)
+
+	remotePath := t.TempDir()
+	_, err = git.PlainInitWithOptions(remotePath, &git.PlainInitOptions{
+		Bare:        true,
+		InitOptions: git.InitOptions{DefaultBranch: plumbing.Main},
+	})
+	require.NoError(t, err)
+
+	_, err = seed.CreateRemote(&config.RemoteConfig{Name: "origin", URLs: []string{remotePath}})
+	require.NoError(t, err)
+	require.NoError(t, seed.Push(&git.PushOptions{RemoteName: "origin"}))
+
+	return remotePath
+}
@@ -0,0 +1,150 @@
+package git
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// Diff is the difference between HEAD and the worktree of a repository.
+type Diff struct {
+	// Patch is the unified diff in git format, suitable for `git apply`.
+	Patch        string
+	FilesChanged int
+	Insertions   int
+	Deletions    int
+	stats        object.FileStats
+}
+
+// Stat returns a diffstat similar to `git diff --stat`.
+func (d *Diff) Stat() string {
+	var sb strings.Builder
+	sb.WriteString(d.stats.String())
+	fmt.Fprintf(&sb, " %d %s changed, %d %s(+), %d %s(-)\n",
+		d.FilesChanged, plural(d.FilesChanged, "file", "files"),
+		d.Insertions, plural(d.Insertions, "insertion", "insertions"),
+		d.Deletions, plural(d.Deletions, "deletion", "deletions"))
+	return sb.String()
+}
+
+// WorktreeDiff returns the difference between HEAD and the worktree at repoPath, including untracked and deleted
+// files. The changes are captured in a temporary commit that is reset afterwards, so the worktree is left as it was
+// and HEAD doesn't move.
+func WorktreeDiff(repoPath string) (*Diff, error) {
+	repo, err := git.PlainOpen(repoPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open local repo: %w", err)
+	}
+
+	wt, err := repo.Worktree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get worktree: %w", err)
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get HEAD: %w", err)
+	}
+	headCommit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get HEAD commit: %w", err)
+	}
+
+	if err := wt.AddWithOptions(&git.AddOptions{All: true}); err != nil {
+		return nil, fmt.Errorf("failed to stage changes: %w", err)
+	}
+
+	hash, err := wt.Commit("metamorph dry run", &git.CommitOptions{
+		Author:            &object.Signature{Name: "metamorph", Email: "metamorph@localhost", When: time.Now()},
+		AllowEmptyCommits: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to snapshot changes: %w", err)
+	}
+
+	// move HEAD and the index back, keeping the changes in the worktree
+	defer func() {
+		_ = wt.Reset(&git.ResetOptions{Commit: head.Hash(), Mode: git.MixedReset})
+	}()
+
+	snapshot, err := repo.CommitObject(hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get snapshot commit: %w", err)
+	}
+
+	patch, err := headCommit.Patch(snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute diff: %w", err)
+	}
+
+	diff := &Diff{
+		Patch: patch.String(),
+		stats: patch.Stats(),
+	}
+	diff.FilesChanged = len(diff.stats)
+	for _, stat := range diff.stats {
+		diff.Insertions += stat.Addition
+		diff.Deletions += stat.Deletion
+	}
+
+	return diff, nil
+}
+
+// WorktreeFingerprint returns a hash of the uncommitted changes of the worktree at repoPath. Comparing the fingerprint
+// before and after a command tells whether the command changed the worktree, even when it modified files that were
+// already dirty. The fingerprint of a clean worktree is empty.
+func WorktreeFingerprint(repoPath string) (string, error) {
+	repo, err := git.PlainOpen(repoPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open local repo: %w", err)
+	}
+
+	wt, err := repo.Worktree()
+	if err != nil {
+		return "", fmt.Errorf("failed to get worktree: %w", err)
+	}
+
+	status, err := wt.Status()
+	if err != nil {
+		return "", fmt.Errorf("failed to get worktree status: %w", err)
+	}
+	if status.IsClean() {
+		return "", nil
+	}
+
+	paths := make([]string, 0, len(status))
+	for path := range status {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	h := sha256.New()
+	for _, path := range paths {
+		fileStatus := status[path]
+		fmt.Fprintf(h, "%s %c%c\n", path, fileStatus.Staging, fileStatus.Worktree)
+
+		data, err := os.ReadFile(filepath.Join(repoPath, path))
+		if err != nil && !os.IsNotExist(err) {
+			return "", fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		contentHash := sha256.Sum256(data)
+		h.Write(contentHash[:])
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func plural(n int, singular, plural string) string {
+	if n == 1 {
+		return singular
+	}
+	return plural
+}
@@ -0,0 +1,64 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorktreeDiff(t *testing.T) {
+	t.Parallel()
+
+	dest := t.TempDir()
+	require.NoError(t, Clone(CloneOptions{URL: newTestRemote(t), Destination: dest}))
+
+	require.NoError(t, os.WriteFile(filepath.Join(dest, "README.md"), []byte("# test\nmore\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dest, "new.txt"), []byte("hello\n"), 0o644))
+
+	diff, err := WorktreeDiff(dest)
+	require.NoError(t, err)
+	require.Equal(t, 2, diff.FilesChanged)
+	require.Equal(t, 2, diff.Insertions)
+	require.Equal(t, 0, diff.Deletions)
+	require.Contains(t, diff.Patch, "diff --git a/README.md b/README.md")
+	require.Contains(t, diff.Patch, "+more")
+	require.Contains(t, diff.Patch, "+++ b/new.txt")
+	require.Contains(t, diff.Stat(), "2 files changed, 2 insertions(+), 0 deletions(-)")
+
+	// the worktree still has the changes and HEAD hasn't moved
+	dirty, err := HasChanges(dest)
+	require.NoError(t, err)
+	require.True(t, dirty)
+
+	diff, err = WorktreeDiff(dest)
+	require.NoError(t, err)
+	require.Equal(t, 2, diff.FilesChanged)
+}
+
+func TestWorktreeFingerprint(t *testing.T) {
+	t.Parallel()
+
+	dest := t.TempDir()
+	require.NoError(t, Clone(CloneOptions{URL: newTestRemote(t), Destination: dest}))
+
+	clean, err := WorktreeFingerprint(dest)
+	require.NoError(t, err)
+	require.Empty(t, clean)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dest, "README.md"), []byte("# changed\n"), 0o644))
+	first, err := WorktreeFingerprint(dest)
+	require.NoError(t, err)
+	require.NotEmpty(t, first)
+
+	same, err := WorktreeFingerprint(dest)
+	require.NoError(t, err)
+	require.Equal(t, first, same)
+
+	// changing an already modified file changes the fingerprint
+	require.NoError(t, os.WriteFile(filepath.Join(dest, "README.md"), []byte("# changed again\n"), 0o644))
+	second, err := WorktreeFingerprint(dest)
+	require.NoError(t, err)
+	require.NotEqual(t, first, second)
+}
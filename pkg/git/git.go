@@ -1,6 +1,7 @@
 package git
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/go-git/go-git/v5"
@@ -13,11 +14,19 @@ type CloneOptions struct {
 	Branch      string
 	Destination string
 	Auth        transport.AuthMethod
+	CABundle    []byte
 }
 
+// Clone clones the repository described by opts.
 func Clone(opts CloneOptions) error {
+	return CloneContext(context.Background(), opts)
+}
+
+// CloneContext clones the repository described by opts. The clone is aborted when ctx is cancelled.
+func CloneContext(ctx context.Context, opts CloneOptions) error {
 	cloneOpts := &git.CloneOptions{
-		URL: opts.URL,
+		URL:      opts.URL,
+		CABundle: opts.CABundle,
 	}
 
 	if opts.Auth != nil {
@@ -29,10 +38,39 @@ func Clone(opts CloneOptions) error {
 		cloneOpts.SingleBranch = true
 	}
 
-	_, err := git.PlainClone(opts.Destination, false, cloneOpts)
+	_, err := git.PlainCloneContext(ctx, opts.Destination, false, cloneOpts)
 	if err != nil {
 		return fmt.Errorf("failed to clone repository: %w", err)
 	}
 
 	return nil
 }
+
+// CheckoutRevision checks out the given revision of the repository at repoPath, leaving HEAD detached. The revision
+// can be a branch, including branches that only exist on the origin remote, a tag or a commit hash.
+func CheckoutRevision(repoPath, revision string) error {
+	repo, err := git.PlainOpen(repoPath)
+	if err != nil {
+		return fmt.Errorf("failed to open repository: %w", err)
+	}
+
+	var hash *plumbing.Hash
+	for _, candidate := range []string{revision, "refs/remotes/origin/" + revision, "refs/tags/" + revision} {
+		if hash, err = repo.ResolveRevision(plumbing.Revision(candidate)); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("unknown revision %s: %w", revision, err)
+	}
+
+	wt, err := repo.Worktree()
+	if err != nil {
+		return fmt.Errorf("failed to get worktree: %w", err)
+	}
+	if err := wt.Checkout(&git.CheckoutOptions{Hash: *hash, Force: true}); err != nil {
+		return fmt.Errorf("failed to check out %s: %w", revision, err)
+	}
+
+	return nil
+}
@@ -15,3 +15,21 @@ func OpenRepo(repoPath string, tempDir string) (*git.Repository, error) {
 
 	return repo, nil
 }
+
+// CurrentBranch returns the short name of the branch checked out at repoPath.
+func CurrentBranch(repoPath string) (string, error) {
+	repo, err := git.PlainOpen(repoPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open local repo: %w", err)
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve HEAD: %w", err)
+	}
+	if !head.Name().IsBranch() {
+		return "", fmt.Errorf("HEAD is not a branch: %s", head.Name())
+	}
+
+	return head.Name().Short(), nil
+}
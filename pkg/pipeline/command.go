@@ -0,0 +1,146 @@
+package pipeline
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// ShellSh runs the step script with /bin/sh, which is available in virtually every image including alpine.
+	ShellSh = "sh"
+	// ShellBash runs the step script with /bin/bash.
+	ShellBash = "bash"
+	// ShellNone executes the command directly without a shell. The command is split into arguments using shell
+	// quoting rules, but variables, pipes and redirects are not interpreted.
+	ShellNone = "none"
+	// ShellExec is an alias of ShellNone matching the Dockerfile "exec form".
+	ShellExec = "exec"
+)
+
+// shellPaths maps the supported shells to the interpreter inside the container.
+var shellPaths = map[string]string{
+	ShellSh:   "/bin/sh",
+	ShellBash: "/bin/bash",
+}
+
+// Script returns the script of the step, which is either the run block or the legacy single-line command.
+func (s *Step) Script() string {
+	if s.Run != "" {
+		return s.Run
+	}
+	return s.Command
+}
+
+// buildCommand resolves the argv executed in the container from the command, run, args and shell options.
+func (s *Step) buildCommand() ([]string, error) {
+	script := s.Script()
+
+	if s.Command != "" && s.Run != "" {
+		return nil, fmt.Errorf("command and run are mutually exclusive, use run for multi-line scripts")
+	}
+
+	if len(s.Args) > 0 {
+		if script != "" {
+			return nil, fmt.Errorf("args can't be combined with command or run")
+		}
+		if s.Shell != "" && !isExecShell(s.Shell) {
+			return nil, fmt.Errorf("args are executed without a shell, remove shell: %s or use run instead", s.Shell)
+		}
+		return append([]string(nil), s.Args...), nil
+	}
+
+	if strings.TrimSpace(script) == "" {
+		return nil, fmt.Errorf("must specify one of command, run or args")
+	}
+
+	shell := s.Shell
+	if shell == "" {
+		shell = ShellSh
+	}
+
+	if isExecShell(shell) {
+		if strings.Contains(strings.TrimSpace(script), "\n") {
+			return nil, fmt.Errorf("multi-line scripts require a shell, set shell to %s or %s", ShellSh, ShellBash)
+		}
+		return splitArgs(script)
+	}
+
+	path, ok := shellPaths[shell]
+	if !ok {
+		return nil, fmt.Errorf("unknown shell %q, must be one of %s, %s, %s or %s", shell, ShellSh, ShellBash, ShellNone, ShellExec)
+	}
+
+	// errexit makes multi-line scripts fail on the first failing command, like a CI job would
+	return []string{path, "-e", "-c", script}, nil
+}
+
+func isExecShell(shell string) bool {
+	return shell == ShellNone || shell == ShellExec
+}
+
+// splitArgs splits a command line into arguments using POSIX shell quoting rules: whitespace separates arguments,
+// single quotes preserve everything literally, double quotes allow backslash escapes of ", \, $ and `, and a
+// backslash outside of quotes escapes the next character.
+func splitArgs(s string) ([]string, error) {
+	var (
+		args    []string
+		current strings.Builder
+		inArg   bool
+	)
+
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '\'':
+			inArg = true
+			end := indexRune(runes, i+1, '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated single quote in %q", s)
+			}
+			current.WriteString(string(runes[i+1 : end]))
+			i = end
+		case r == '"':
+			inArg = true
+			i++
+			for ; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) && strings.ContainsRune("\"\\$`", runes[i+1]) {
+					i++
+				}
+				current.WriteRune(runes[i])
+			}
+			if i >= len(runes) {
+				return nil, fmt.Errorf("unterminated double quote in %q", s)
+			}
+		case r == '\\':
+			inArg = true
+			if i+1 < len(runes) {
+				i++
+				current.WriteRune(runes[i])
+			}
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			inArg = true
+			current.WriteRune(r)
+		}
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+
+	return args, nil
+}
+
+func indexRune(runes []rune, from int, r rune) int {
+	for i := from; i < len(runes); i++ {
+		if runes[i] == r {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,74 @@
+package pipeline
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStepCommands(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name             string
+		step             string
+		expectedCommands []string
+		expectedError    string
+	}{
+		{
+			"Command with quotes",
+			`command: /scripts/upgrade-yarn-pkg "@types/node" "^22.10.5"`,
+			[]string{"/bin/sh", "-e", "-c", `/scripts/upgrade-yarn-pkg "@types/node" "^22.10.5"`},
+			"",
+		},
+		{
+			"Multi-line run with bash",
+			"shell: bash\n    run: |\n      yarn install\n      yarn test",
+			[]string{"/bin/bash", "-e", "-c", "yarn install\nyarn test\n"},
+			"",
+		},
+		{
+			"Exec form",
+			`shell: none` + "\n" + `    command: /scripts/upgrade-yarn-pkg "@types/node" '^22.10.5' a\ b`,
+			[]string{"/scripts/upgrade-yarn-pkg", "@types/node", "^22.10.5", "a b"},
+			"",
+		},
+		{
+			"Args",
+			`args: ["/scripts/upgrade-yarn-pkg", "@types/node", "^22.10.5"]`,
+			[]string{"/scripts/upgrade-yarn-pkg", "@types/node", "^22.10.5"},
+			"",
+		},
+		{"Nothing to run", "", nil, "must specify one of command, run or args"},
+		{"Command and run", "command: ls\n    run: ls", nil, "command and run are mutually exclusive"},
+		{"Args and run", "run: ls\n    args: [ls]", nil, "args can't be combined with command or run"},
+		{"Args with shell", "shell: bash\n    args: [ls]", nil, "args are executed without a shell"},
+		{"Unknown shell", "shell: zsh\n    run: ls", nil, `unknown shell "zsh"`},
+		{"Multi-line exec", "shell: exec\n    run: |\n      ls\n      pwd", nil, "multi-line scripts require a shell"},
+		{"Unterminated quote", "shell: none\n    command: echo \"hello", nil, "unterminated double quote"},
+	}
+
+	for _, testCase := range testCases {
+		// The following is necessary to make sure testCase's values don't
+		// get updated due to concurrency within the scope of t.Run(..) below
+		testCase := testCase
+
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			manifest := "steps:\n  - name: test\n    image: alpine\n"
+			if testCase.step != "" {
+				manifest += "    " + testCase.step + "\n"
+			}
+
+			p := &Pipeline{}
+			err := parseFile(p, manifest)
+			if testCase.expectedError != "" {
+				require.ErrorContains(t, err, testCase.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, testCase.expectedCommands, p.Steps[0].Commands())
+		})
+	}
+}
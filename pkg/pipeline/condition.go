@@ -0,0 +1,186 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Condition is a repo-level precondition that is evaluated after the repo is cloned and before any step runs.
+// Exactly one of the fields must be set.
+type Condition struct {
+	// FileExists is a path, relative to the repo root, that must exist.
+	FileExists string `yaml:"file_exists,omitempty"`
+	// FileContains matches a regular expression against the contents of a file.
+	FileContains *FileContains `yaml:"file_contains,omitempty"`
+	// PathMatches matches a regular expression against a value inside a JSON or YAML file.
+	PathMatches *PathMatches `yaml:"path_matches,omitempty"`
+}
+
+// FileContains matches a regular expression against the contents of a file.
+type FileContains struct {
+	File    string `yaml:"file"`
+	Pattern string `yaml:"pattern"`
+}
+
+// PathMatches matches a regular expression against the value at a dot-separated path inside a JSON or YAML file,
+// e.g. "engines.node" or "services.0.image". Numeric segments index into lists.
+type PathMatches struct {
+	File    string `yaml:"file"`
+	Path    string `yaml:"path"`
+	Pattern string `yaml:"pattern"`
+}
+
+// validate checks that exactly one kind of condition is set and that it is well formed.
+func (c Condition) validate() error {
+	set := 0
+	if c.FileExists != "" {
+		set++
+		if err := validateRepoPath(c.FileExists); err != nil {
+			return err
+		}
+	}
+	if c.FileContains != nil {
+		set++
+		if err := validateRepoPath(c.FileContains.File); err != nil {
+			return err
+		}
+		if _, err := regexp.Compile(c.FileContains.Pattern); err != nil {
+			return fmt.Errorf("invalid file_contains pattern: %w", err)
+		}
+	}
+	if c.PathMatches != nil {
+		set++
+		if err := validateRepoPath(c.PathMatches.File); err != nil {
+			return err
+		}
+		if c.PathMatches.Path == "" {
+			return fmt.Errorf("path_matches must specify a path")
+		}
+		if _, err := regexp.Compile(c.PathMatches.Pattern); err != nil {
+			return fmt.Errorf("invalid path_matches pattern: %w", err)
+		}
+	}
+
+	if set != 1 {
+		return fmt.Errorf("a condition must specify exactly one of file_exists, file_contains or path_matches")
+	}
+	return nil
+}
+
+// Evaluate checks the condition against the repo at repoPath. When the condition doesn't match, the returned string
+// describes why.
+func (c Condition) Evaluate(repoPath string) (bool, string, error) {
+	switch {
+	case c.FileExists != "":
+		_, err := os.Stat(filepath.Join(repoPath, c.FileExists))
+		if errors.Is(err, os.ErrNotExist) {
+			return false, fmt.Sprintf("%s does not exist", c.FileExists), nil
+		}
+		return err == nil, "", err
+
+	case c.FileContains != nil:
+		data, ok, err := readRepoFile(repoPath, c.FileContains.File)
+		if !ok || err != nil {
+			return false, fmt.Sprintf("%s does not exist", c.FileContains.File), err
+		}
+		if !regexp.MustCompile(c.FileContains.Pattern).Match(data) {
+			return false, fmt.Sprintf("%s does not contain %q", c.FileContains.File, c.FileContains.Pattern), nil
+		}
+		return true, "", nil
+
+	case c.PathMatches != nil:
+		data, ok, err := readRepoFile(repoPath, c.PathMatches.File)
+		if !ok || err != nil {
+			return false, fmt.Sprintf("%s does not exist", c.PathMatches.File), err
+		}
+		value, found, err := lookupPath(data, c.PathMatches.Path)
+		if err != nil {
+			return false, "", fmt.Errorf("unable to parse %s: %w", c.PathMatches.File, err)
+		}
+		if !found {
+			return false, fmt.Sprintf("%s has no %s", c.PathMatches.File, c.PathMatches.Path), nil
+		}
+		if !regexp.MustCompile(c.PathMatches.Pattern).MatchString(value) {
+			return false, fmt.Sprintf("%s of %s is %q, which does not match %q", c.PathMatches.Path, c.PathMatches.File, value, c.PathMatches.Pattern), nil
+		}
+		return true, "", nil
+	}
+
+	return false, "", fmt.Errorf("empty condition")
+}
+
+// Matches evaluates the preconditions of the pipeline against the repo at repoPath. Every condition must match.
+func (p *Pipeline) Matches(repoPath string) (bool, string, error) {
+	for _, condition := range p.When {
+		ok, reason, err := condition.Evaluate(repoPath)
+		if err != nil || !ok {
+			return false, reason, err
+		}
+	}
+	return true, "", nil
+}
+
+// validateRepoPath checks the path is relative and stays inside the repo.
+func validateRepoPath(path string) error {
+	if path == "" {
+		return fmt.Errorf("a condition must specify a file")
+	}
+	if !filepath.IsLocal(path) {
+		return fmt.Errorf("condition file %q must be a relative path inside the repo", path)
+	}
+	return nil
+}
+
+// readRepoFile reads a file of the repo. A missing file is not an error.
+func readRepoFile(repoPath, path string) ([]byte, bool, error) {
+	data, err := os.ReadFile(filepath.Join(repoPath, path))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+// lookupPath returns the scalar value at the dot-separated path of a JSON or YAML document. JSON is parsed as YAML,
+// which it is a subset of.
+func lookupPath(data []byte, path string) (string, bool, error) {
+	var doc any
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return "", false, err
+	}
+
+	value := doc
+	for _, segment := range strings.Split(path, ".") {
+		switch v := value.(type) {
+		case map[string]any:
+			next, ok := v[segment]
+			if !ok {
+				return "", false, nil
+			}
+			value = next
+		case []any:
+			i, err := strconv.Atoi(segment)
+			if err != nil || i < 0 || i >= len(v) {
+				return "", false, nil
+			}
+			value = v[i]
+		default:
+			return "", false, nil
+		}
+	}
+
+	switch value.(type) {
+	case nil, map[string]any, []any:
+		return "", false, nil
+	}
+	return fmt.Sprint(value), true, nil
+}
@@ -0,0 +1,71 @@
+package pipeline
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConditionEvaluate(t *testing.T) {
+	t.Parallel()
+
+	repoPath := t.TempDir()
+	packageJSON := `{"name": "es-indexer", "engines": {"node": ">=18"}, "workspaces": ["api", "worker"]}`
+	require.NoError(t, os.WriteFile(filepath.Join(repoPath, "package.json"), []byte(packageJSON), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(repoPath, ".gitlab-ci.yml"), []byte("image: node:18\nstages: [test]\n"), 0o644))
+
+	testCases := []struct {
+		name           string
+		condition      Condition
+		expectedMatch  bool
+		expectedReason string
+	}{
+		{"File exists", Condition{FileExists: "package.json"}, true, ""},
+		{"File missing", Condition{FileExists: "go.mod"}, false, "go.mod does not exist"},
+		{"File contains", Condition{FileContains: &FileContains{File: "package.json", Pattern: `"node":\s*">=1[68]"`}}, true, ""},
+		{"File doesn't contain", Condition{FileContains: &FileContains{File: "package.json", Pattern: "typescript"}}, false, `package.json does not contain "typescript"`},
+		{"File contains missing file", Condition{FileContains: &FileContains{File: "yarn.lock", Pattern: "."}}, false, "yarn.lock does not exist"},
+		{"JSON path matches", Condition{PathMatches: &PathMatches{File: "package.json", Path: "engines.node", Pattern: "^>=1[68]$"}}, true, ""},
+		{"JSON list index", Condition{PathMatches: &PathMatches{File: "package.json", Path: "workspaces.1", Pattern: "worker"}}, true, ""},
+		{"JSON path doesn't match", Condition{PathMatches: &PathMatches{File: "package.json", Path: "engines.node", Pattern: "^22"}}, false, `engines.node of package.json is ">=18", which does not match "^22"`},
+		{"JSON path missing", Condition{PathMatches: &PathMatches{File: "package.json", Path: "engines.npm", Pattern: "."}}, false, "package.json has no engines.npm"},
+		{"YAML path matches", Condition{PathMatches: &PathMatches{File: ".gitlab-ci.yml", Path: "image", Pattern: "^node:18"}}, true, ""},
+	}
+
+	for _, testCase := range testCases {
+		// The following is necessary to make sure testCase's values don't
+		// get updated due to concurrency within the scope of t.Run(..) below
+		testCase := testCase
+
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			require.NoError(t, testCase.condition.validate())
+			matched, reason, err := testCase.condition.Evaluate(repoPath)
+			require.NoError(t, err)
+			require.Equal(t, testCase.expectedMatch, matched)
+			require.Equal(t, testCase.expectedReason, reason)
+		})
+	}
+}
+
+func TestValidateConditions(t *testing.T) {
+	t.Parallel()
+
+	steps := "steps:\n  - name: test\n    image: alpine\n    command: ls\n"
+
+	p := &Pipeline{}
+	require.NoError(t, parseFile(p, "when:\n  - file_exists: package.json\n  - path_matches: {file: package.json, path: engines.node, pattern: '^>=18'}\n"+steps))
+	require.Len(t, p.When, 2)
+
+	err := parseFile(&Pipeline{}, "when:\n  - file_exists: package.json\n    file_contains: {file: package.json, pattern: node}\n"+steps)
+	require.ErrorContains(t, err, "when condition 0: a condition must specify exactly one of")
+
+	err = parseFile(&Pipeline{}, "when:\n  - file_exists: ../other/package.json\n"+steps)
+	require.ErrorContains(t, err, "must be a relative path inside the repo")
+
+	err = parseFile(&Pipeline{}, "when:\n  - file_contains: {file: package.json, pattern: '('}\n"+steps)
+	require.ErrorContains(t, err, "invalid file_contains pattern")
+}
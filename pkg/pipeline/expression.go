@@ -0,0 +1,653 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Expression is a parsed step condition, e.g.
+//
+//	exists('yarn.lock') && steps.upgrade.changed
+//	repo.name != 'backend/legacy' || vars.FORCE == 'true'
+//
+// Expressions support string, number and boolean literals, the operators ==, !=, &&, || and !, parentheses,
+// references into the ExpressionContext and the functions exists, contains, startsWith, endsWith, matches, success
+// and failure.
+type Expression struct {
+	source string
+	root   exprNode
+}
+
+// ExpressionContext is the data step conditions and step templates are evaluated against.
+type ExpressionContext struct {
+	// RepoPath is the root of the cloned repo on the host, used by exists().
+	RepoPath string
+	// Repo describes the repository.
+	Repo RepoContext
+	// Vars are the variables of the repo.
+	Vars map[string]string
+	// Params are the parameters of the step template the step uses.
+	Params map[string]string
+	// Steps are the outcomes of the steps that already ran, keyed by step name.
+	Steps map[string]StepContext
+	// Changed is true when the worktree has uncommitted changes.
+	Changed bool
+}
+
+// RepoContext describes the repository a condition or template is evaluated for.
+type RepoContext struct {
+	// Name is the name of the repository relative to the platform org, e.g. "backend/es-indexer".
+	Name string
+	// Path is the full path of the repository on the platform, including the org, e.g. "myorg/backend/es-indexer".
+	Path string
+	// BaseBranch is the branch that was cloned and that the change request targets, usually the default branch.
+	BaseBranch string
+}
+
+// DefaultBranch returns the base branch. It lets templates use {{ .Repo.DefaultBranch }}.
+func (r RepoContext) DefaultBranch() string {
+	return r.BaseBranch
+}
+
+// StepContext is the outcome of a previous step.
+type StepContext struct {
+	// Outcome is the status of the step: succeeded, failed, timed-out or skipped.
+	Outcome  string
+	ExitCode int
+	// Changed is true when the step modified the worktree.
+	Changed bool
+	// Outputs are the key=value pairs the step wrote to $METAMORPH_OUTPUT.
+	Outputs map[string]string
+}
+
+// exprFunctions maps the supported functions to their number of arguments.
+var exprFunctions = map[string]int{
+	"exists":     1,
+	"contains":   2,
+	"startsWith": 2,
+	"endsWith":   2,
+	"matches":    2,
+	"success":    0,
+	"failure":    0,
+}
+
+var (
+	repoFields = []string{"name", "path", "base_branch", "default_branch"}
+	stepFields = []string{"outcome", "exit_code", "changed"}
+)
+
+// ParseExpression parses the expression and checks it only references the given steps.
+func ParseExpression(source string, steps []string) (*Expression, error) {
+	p := &exprParser{source: source}
+	if err := p.tokenize(); err != nil {
+		return nil, err
+	}
+
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q at position %d", tok.text, tok.pos)
+	}
+
+	if err := root.check(steps); err != nil {
+		return nil, err
+	}
+
+	return &Expression{source: source, root: root}, nil
+}
+
+// String returns the source of the expression.
+func (e *Expression) String() string {
+	return e.source
+}
+
+// Eval evaluates the expression and returns its truthiness.
+func (e *Expression) Eval(ctx *ExpressionContext) (bool, error) {
+	v, err := e.root.eval(ctx)
+	if err != nil {
+		return false, err
+	}
+	return truthy(v), nil
+}
+
+// exprNode is a node of the expression syntax tree.
+type exprNode interface {
+	eval(ctx *ExpressionContext) (any, error)
+	// check validates the references and function calls of the node against the known steps.
+	check(steps []string) error
+}
+
+type literalNode struct {
+	value any
+}
+
+type refNode struct {
+	path []string
+}
+
+type notNode struct {
+	x exprNode
+}
+
+type binaryNode struct {
+	op   string
+	x, y exprNode
+}
+
+type callNode struct {
+	name string
+	args []exprNode
+}
+
+func (n literalNode) eval(*ExpressionContext) (any, error) { return n.value, nil }
+func (n literalNode) check([]string) error                 { return nil }
+
+func (n refNode) eval(ctx *ExpressionContext) (any, error) {
+	switch n.path[0] {
+	case "changed":
+		return ctx.Changed, nil
+	case "repo":
+		switch n.path[1] {
+		case "name":
+			return ctx.Repo.Name, nil
+		case "path":
+			return ctx.Repo.Path, nil
+		default:
+			return ctx.Repo.BaseBranch, nil
+		}
+	case "vars":
+		if v, ok := ctx.Vars[n.path[1]]; ok {
+			return v, nil
+		}
+		return nil, nil
+	case "params":
+		if v, ok := ctx.Params[n.path[1]]; ok {
+			return v, nil
+		}
+		return nil, nil
+	case "steps":
+		step, ok := ctx.Steps[n.path[1]]
+		if !ok {
+			return nil, nil
+		}
+		switch n.path[2] {
+		case "outcome":
+			return step.Outcome, nil
+		case "exit_code":
+			return float64(step.ExitCode), nil
+		case "outputs":
+			if v, ok := step.Outputs[n.path[3]]; ok {
+				return v, nil
+			}
+			return nil, nil
+		default:
+			return step.Changed, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown reference %s", strings.Join(n.path, "."))
+}
+
+func (n refNode) check(steps []string) error {
+	ref := strings.Join(n.path, ".")
+	switch n.path[0] {
+	case "changed":
+		if len(n.path) != 1 {
+			return fmt.Errorf("unknown reference %s", ref)
+		}
+	case "repo":
+		if len(n.path) != 2 || !contains(repoFields, n.path[1]) {
+			return fmt.Errorf("unknown reference %s, repo has %s", ref, strings.Join(repoFields, ", "))
+		}
+	case "vars":
+		if len(n.path) != 2 {
+			return fmt.Errorf("unknown reference %s, use vars.NAME", ref)
+		}
+	case "params":
+		if len(n.path) != 2 {
+			return fmt.Errorf("unknown reference %s, use params.NAME", ref)
+		}
+	case "steps":
+		validOutput := len(n.path) == 4 && n.path[2] == "outputs"
+		if !validOutput && (len(n.path) != 3 || !contains(stepFields, n.path[2])) {
+			return fmt.Errorf("unknown reference %s, use steps.NAME.%s or steps.NAME.outputs.KEY", ref, strings.Join(stepFields, "|"))
+		}
+		if !contains(steps, n.path[1]) {
+			return fmt.Errorf("reference to unknown or later step %q", n.path[1])
+		}
+	default:
+		return fmt.Errorf("unknown reference %s, must start with repo, vars, params, steps or changed", ref)
+	}
+	return nil
+}
+
+func (n notNode) eval(ctx *ExpressionContext) (any, error) {
+	v, err := n.x.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return !truthy(v), nil
+}
+
+func (n notNode) check(steps []string) error { return n.x.check(steps) }
+
+func (n binaryNode) eval(ctx *ExpressionContext) (any, error) {
+	x, err := n.x.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// && and || short circuit like they do in most languages
+	switch n.op {
+	case "&&":
+		if !truthy(x) {
+			return false, nil
+		}
+	case "||":
+		if truthy(x) {
+			return true, nil
+		}
+	}
+
+	y, err := n.y.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return equal(x, y), nil
+	case "!=":
+		return !equal(x, y), nil
+	default:
+		return truthy(y), nil
+	}
+}
+
+func (n binaryNode) check(steps []string) error {
+	if err := n.x.check(steps); err != nil {
+		return err
+	}
+	return n.y.check(steps)
+}
+
+func (n callNode) eval(ctx *ExpressionContext) (any, error) {
+	args := make([]string, 0, len(n.args))
+	for _, arg := range n.args {
+		v, err := arg.eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, toString(v))
+	}
+
+	switch n.name {
+	case "exists":
+		// paths built from vars or repo fields are only known now, so they are confined to the repo here
+		if !filepath.IsLocal(args[0]) {
+			return nil, fmt.Errorf("exists() path %q must be a relative path inside the repo", args[0])
+		}
+		_, err := os.Stat(filepath.Join(ctx.RepoPath, args[0]))
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return err == nil, err
+	case "contains":
+		return strings.Contains(args[0], args[1]), nil
+	case "startsWith":
+		return strings.HasPrefix(args[0], args[1]), nil
+	case "endsWith":
+		return strings.HasSuffix(args[0], args[1]), nil
+	case "matches":
+		re, err := regexp.Compile(args[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern in matches(): %w", err)
+		}
+		return re.MatchString(args[0]), nil
+	case "success", "failure":
+		failed := false
+		for _, step := range ctx.Steps {
+			if step.Outcome == "failed" || step.Outcome == "timed-out" {
+				failed = true
+			}
+		}
+		return failed == (n.name == "failure"), nil
+	}
+	return nil, fmt.Errorf("unknown function %s", n.name)
+}
+
+func (n callNode) check(steps []string) error {
+	arity, ok := exprFunctions[n.name]
+	if !ok {
+		return fmt.Errorf("unknown function %s", n.name)
+	}
+	if len(n.args) != arity {
+		return fmt.Errorf("%s() takes %d arguments, got %d", n.name, arity, len(n.args))
+	}
+
+	for _, arg := range n.args {
+		if err := arg.check(steps); err != nil {
+			return err
+		}
+	}
+
+	// catch mistakes in literal arguments early
+	switch n.name {
+	case "exists":
+		if lit, ok := n.args[0].(literalNode); ok && !filepath.IsLocal(toString(lit.value)) {
+			return fmt.Errorf("exists() path %q must be a relative path inside the repo", toString(lit.value))
+		}
+	case "matches":
+		if lit, ok := n.args[1].(literalNode); ok {
+			if _, err := regexp.Compile(toString(lit.value)); err != nil {
+				return fmt.Errorf("invalid pattern in matches(): %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// truthy returns false for false, null, empty strings and zero, and true for anything else.
+func truthy(v any) bool {
+	switch v := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case string:
+		return v != ""
+	case float64:
+		return v != 0
+	}
+	return true
+}
+
+// equal compares values of the same type directly and values of different types by their string form.
+func equal(x, y any) bool {
+	if x == nil || y == nil {
+		return x == y
+	}
+	switch x.(type) {
+	case bool, string, float64:
+		if fmt.Sprintf("%T", x) == fmt.Sprintf("%T", y) {
+			return x == y
+		}
+	}
+	return toString(x) == toString(y)
+}
+
+func toString(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// exprParser is a recursive descent parser for expressions. The grammar, from lowest to highest precedence, is:
+//
+//	or      = and { "||" and }
+//	and     = compare { "&&" compare }
+//	compare = unary [ ("==" | "!=") unary ]
+//	unary   = "!" unary | primary
+//	primary = literal | "(" or ")" | ident "(" [ or { "," or } ] ")" | ident { "." ident | "[" string "]" }
+type exprParser struct {
+	source string
+	tokens []token
+	pos    int
+}
+
+func (p *exprParser) tokenize() error {
+	src := p.source
+	for i := 0; i < len(src); {
+		c := rune(src[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '\'' || c == '"':
+			var sb strings.Builder
+			j := i + 1
+			for ; j < len(src) && rune(src[j]) != c; j++ {
+				if src[j] == '\\' && j+1 < len(src) {
+					j++
+				}
+				sb.WriteByte(src[j])
+			}
+			if j >= len(src) {
+				return fmt.Errorf("unterminated string at position %d", i)
+			}
+			p.tokens = append(p.tokens, token{tokString, sb.String(), i})
+			i = j + 1
+		case c >= '0' && c <= '9':
+			j := i
+			for j < len(src) && (src[j] >= '0' && src[j] <= '9' || src[j] == '.') {
+				j++
+			}
+			p.tokens = append(p.tokens, token{tokNumber, src[i:j], i})
+			i = j
+		case c == '_' || unicode.IsLetter(c):
+			j := i
+			for j < len(src) && (src[j] == '_' || src[j] == '-' || unicode.IsLetter(rune(src[j])) || unicode.IsDigit(rune(src[j]))) {
+				j++
+			}
+			p.tokens = append(p.tokens, token{tokIdent, src[i:j], i})
+			i = j
+		default:
+			op := ""
+			for _, candidate := range []string{"==", "!=", "&&", "||", "!", "(", ")", ".", ",", "[", "]"} {
+				if strings.HasPrefix(src[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return fmt.Errorf("unexpected character %q at position %d", c, i)
+			}
+			p.tokens = append(p.tokens, token{tokOp, op, i})
+			i += len(op)
+		}
+	}
+	p.tokens = append(p.tokens, token{tokEOF, "end of expression", len(src)})
+	return nil
+}
+
+func (p *exprParser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *exprParser) accept(op string) bool {
+	if tok := p.peek(); tok.kind == tokOp && tok.text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *exprParser) expect(op string) error {
+	if !p.accept(op) {
+		tok := p.peek()
+		return fmt.Errorf("expected %q but found %q at position %d", op, tok.text, tok.pos)
+	}
+	return nil
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	x, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||") {
+		y, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		x = binaryNode{op: "||", x: x, y: y}
+	}
+	return x, nil
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	x, err := p.parseCompare()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&&") {
+		y, err := p.parseCompare()
+		if err != nil {
+			return nil, err
+		}
+		x = binaryNode{op: "&&", x: x, y: y}
+	}
+	return x, nil
+}
+
+func (p *exprParser) parseCompare() (exprNode, error) {
+	x, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"==", "!="} {
+		if p.accept(op) {
+			y, err := p.parseUnary()
+			if err != nil {
+				return nil, err
+			}
+			return binaryNode{op: op, x: x, y: y}, nil
+		}
+	}
+	return x, nil
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if p.accept("!") {
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{x: x}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokString:
+		return literalNode{value: tok.text}, nil
+	case tokNumber:
+		f, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at position %d", tok.text, tok.pos)
+		}
+		return literalNode{value: f}, nil
+	case tokOp:
+		if tok.text == "(" {
+			x, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			return x, p.expect(")")
+		}
+	case tokIdent:
+		switch tok.text {
+		case "true":
+			return literalNode{value: true}, nil
+		case "false":
+			return literalNode{value: false}, nil
+		case "null":
+			return literalNode{value: nil}, nil
+		}
+		if p.accept("(") {
+			return p.parseCall(tok.text)
+		}
+		return p.parseRef(tok.text)
+	}
+	return nil, fmt.Errorf("unexpected %q at position %d", tok.text, tok.pos)
+}
+
+func (p *exprParser) parseCall(name string) (exprNode, error) {
+	call := callNode{name: name}
+	if p.accept(")") {
+		return call, nil
+	}
+	for {
+		arg, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		call.args = append(call.args, arg)
+		if p.accept(")") {
+			return call, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *exprParser) parseRef(root string) (exprNode, error) {
+	ref := refNode{path: []string{root}}
+	for {
+		switch {
+		case p.accept("."):
+			tok := p.next()
+			if tok.kind != tokIdent {
+				return nil, fmt.Errorf("expected a name after '.' but found %q at position %d", tok.text, tok.pos)
+			}
+			ref.path = append(ref.path, tok.text)
+		case p.accept("["):
+			tok := p.next()
+			if tok.kind != tokString {
+				return nil, fmt.Errorf("expected a string index but found %q at position %d", tok.text, tok.pos)
+			}
+			ref.path = append(ref.path, tok.text)
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+		default:
+			return ref, nil
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package pipeline
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpressionEval(t *testing.T) {
+	t.Parallel()
+
+	repoPath := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(repoPath, "yarn.lock"), []byte{}, 0o644))
+
+	ctx := &ExpressionContext{
+		RepoPath: repoPath,
+		Repo:     RepoContext{Name: "backend/es-indexer", BaseBranch: "main"},
+		Vars:     map[string]string{"FORCE": "true", "RETRIES": "3"},
+		Steps: map[string]StepContext{
+			"clean":     {Outcome: "succeeded", Outputs: map[string]string{"node_version": "22"}},
+			"upgrade":   {Outcome: "succeeded", Changed: true},
+			"run tests": {Outcome: "failed", ExitCode: 2},
+		},
+		Changed: true,
+	}
+	steps := []string{"clean", "upgrade", "run tests"}
+
+	testCases := []struct {
+		expression string
+		expected   bool
+	}{
+		{"exists('yarn.lock')", true},
+		{"exists('package-lock.json')", false},
+		{"!exists('package-lock.json') && exists('yarn.lock')", true},
+		{"steps.upgrade.changed", true},
+		{"steps.clean.outputs.node_version == 22", true},
+		{"steps.clean.changed || steps.upgrade.changed", true},
+		{"steps['run tests'].outcome == 'failed'", true},
+		{"steps['run tests'].exit_code == 2", true},
+		{"repo.name == 'backend/es-indexer' && repo.default_branch == \"main\"", true},
+		{"startsWith(repo.name, 'frontend/')", false},
+		{"matches(repo.name, '^backend/.*-indexer$')", true},
+		{"contains(repo.name, 'es-')", true},
+		{"endsWith(repo.base_branch, 'ain')", true},
+		{"vars.FORCE == 'true'", true},
+		{"vars.RETRIES == 3", true},
+		{"vars.MISSING", false},
+		{"vars.MISSING == null", true},
+		{"changed", true},
+		{"failure()", true},
+		{"success()", false},
+		{"(false || true) && !(true && false)", true},
+	}
+
+	for _, testCase := range testCases {
+		// The following is necessary to make sure testCase's values don't
+		// get updated due to concurrency within the scope of t.Run(..) below
+		testCase := testCase
+
+		t.Run(testCase.expression, func(t *testing.T) {
+			t.Parallel()
+
+			expr, err := ParseExpression(testCase.expression, steps)
+			require.NoError(t, err)
+
+			actual, err := expr.Eval(ctx)
+			require.NoError(t, err)
+			require.Equal(t, testCase.expected, actual)
+		})
+	}
+}
+
+func TestExpressionEvalExistsOutsideRepo(t *testing.T) {
+	t.Parallel()
+
+	repoPath := filepath.Join(t.TempDir(), "repo")
+	require.NoError(t, os.MkdirAll(filepath.Join(repoPath, "docs"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(repoPath, "..", "secret"), []byte{}, 0o644))
+
+	ctx := &ExpressionContext{
+		RepoPath: repoPath,
+		Vars:     map[string]string{"DIR": "docs", "UP": "../secret", "NESTED": "docs/../../secret", "ABS": repoPath},
+	}
+
+	expr, err := ParseExpression("exists(vars.DIR)", nil)
+	require.NoError(t, err)
+	actual, err := expr.Eval(ctx)
+	require.NoError(t, err)
+	require.Equal(t, true, actual)
+
+	for _, expression := range []string{"exists(vars.UP)", "exists(vars.NESTED)", "exists(vars.ABS)"} {
+		expr, err := ParseExpression(expression, nil)
+		require.NoError(t, err, expression)
+		_, err = expr.Eval(ctx)
+		require.ErrorContains(t, err, "must be a relative path inside the repo", expression)
+	}
+}
+
+func TestParseExpressionErrors(t *testing.T) {
+	t.Parallel()
+
+	steps := []string{"clean"}
+
+	testCases := []struct {
+		expression    string
+		expectedError string
+	}{
+		{"exist('yarn.lock')", "unknown function exist"},
+		{"exists()", "exists() takes 1 arguments, got 0"},
+		{"exists('../yarn.lock')", "must be a relative path inside the repo"},
+		{"steps.upgrade.changed", `reference to unknown or later step "upgrade"`},
+		{"steps.clean.status", "unknown reference steps.clean.status"},
+		{"repo.nmae == 'x'", "unknown reference repo.nmae"},
+		{"rep.name", "must start with repo, vars, params, steps or changed"},
+		{"matches(repo.name, '(')", "invalid pattern in matches()"},
+		{"repo.name == 'x", "unterminated string"},
+		{"repo.name = 'x'", "unexpected character '='"},
+		{"(changed", `expected ")"`},
+		{"changed changed", `unexpected "changed"`},
+	}
+
+	for _, testCase := range testCases {
+		// The following is necessary to make sure testCase's values don't
+		// get updated due to concurrency within the scope of t.Run(..) below
+		testCase := testCase
+
+		t.Run(testCase.expression, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := ParseExpression(testCase.expression, steps)
+			require.ErrorContains(t, err, testCase.expectedError)
+		})
+	}
+}
+
+func TestValidateStepIf(t *testing.T) {
+	t.Parallel()
+
+	manifest := `steps:
+  - name: install
+    image: node:22
+    command: yarn install
+    if: exists('yarn.lock')
+  - name: dedupe
+    image: node:22
+    command: yarn dedupe
+    if: steps.install.changed
+`
+	p := &Pipeline{}
+	require.NoError(t, parseFile(p, manifest))
+	require.Equal(t, "exists('yarn.lock')", p.Steps[0].Condition().String())
+	require.Nil(t, (&Step{}).Condition())
+
+	err := parseFile(&Pipeline{}, `steps:
+  - name: install
+    image: node:22
+    command: yarn install
+    if: steps.dedupe.changed
+  - name: dedupe
+    image: node:22
+    command: yarn dedupe
+`)
+	require.ErrorContains(t, err, `step install has an invalid if expression: reference to unknown or later step "dedupe"`)
+}
@@ -0,0 +1,307 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"gopkg.in/yaml.v3"
+
+	"github.com/brightfame/metamorph/internal/config"
+	"github.com/brightfame/metamorph/pkg/git"
+	"github.com/brightfame/metamorph/pkg/scm"
+)
+
+// Include references a manifest whose vars and step templates are merged into the including manifest. Local paths
+// are relative to the including manifest; with Git set, Path is relative to the root of the repository checked out
+// at Ref.
+type Include struct {
+	Path string `yaml:"path"`
+	// Git is the clone URL of the repository the included manifest lives in.
+	Git string `yaml:"git,omitempty"`
+	// Ref is the branch, tag or commit of the repository to use. It defaults to the default branch.
+	Ref string `yaml:"ref,omitempty"`
+}
+
+// UnmarshalYAML accepts either a plain path or a mapping with the path, git and ref fields.
+func (i *Include) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		i.Path = value.Value
+		return nil
+	}
+	type plain Include
+	return value.Decode((*plain)(i))
+}
+
+// String returns the include as written in manifests and error messages, e.g. "git@host:org/lib.git@v1:go.yaml".
+func (i Include) String() string {
+	if i.Git == "" {
+		return i.Path
+	}
+	if i.Ref == "" {
+		return i.Git + ":" + i.Path
+	}
+	return i.Git + "@" + i.Ref + ":" + i.Path
+}
+
+// includableKeys are the top level keys an included manifest may set.
+var includableKeys = []string{"include", "vars", "templates"}
+
+// manifestLoader loads a manifest and, recursively, the manifests it includes.
+type manifestLoader struct {
+	cfg  *config.Config
+	vars map[string]string
+	// checkouts are the directories git includes were cloned into, keyed by URL and ref.
+	checkouts map[string]string
+	// platform provides the credentials for git includes hosted on the SCM platform. It is created on first use.
+	platform scm.Platform
+}
+
+// loadedManifest is a decoded manifest together with where its vars and templates were defined.
+type loadedManifest struct {
+	pipeline        *Pipeline
+	templateSources map[string]string
+	varSources      map[string]string
+}
+
+func newManifestLoader(cfg *config.Config) *manifestLoader {
+	return &manifestLoader{
+		cfg: cfg,
+		vars: map[string]string{
+			"GITLAB_ORG": cfg.PlatformOrg,
+		},
+		checkouts: make(map[string]string),
+	}
+}
+
+// cleanup removes the clones of the git includes.
+func (l *manifestLoader) cleanup() {
+	for _, dir := range l.checkouts {
+		os.RemoveAll(dir)
+	}
+}
+
+// load reads the manifest at path and merges the manifests it includes into it. source names the manifest in error
+// messages and chain holds the sources of the manifests that include it, to detect cycles. Relative volume sources
+// are resolved against dir, which is empty for manifests included from git.
+func (l *manifestLoader) load(ctx context.Context, path, source, dir string, chain []string) (*loadedManifest, error) {
+	for _, s := range chain {
+		if s == source {
+			return nil, fmt.Errorf("include cycle: %s -> %s", strings.Join(chain, " -> "), source)
+		}
+	}
+	chain = append(chain, source)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	expanded := expandEnvVars(data, l.vars)
+
+	p := &Pipeline{}
+	if err := yaml.Unmarshal([]byte(expanded), p); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", source, err)
+	}
+	if len(chain) > 1 {
+		if err := checkIncludable(expanded); err != nil {
+			return nil, fmt.Errorf("%s: %w", source, err)
+		}
+	}
+	if err := p.resolveVolumes(dir); err != nil {
+		return nil, fmt.Errorf("%s: %w", source, err)
+	}
+
+	m := &loadedManifest{
+		pipeline:        p,
+		templateSources: make(map[string]string),
+		varSources:      make(map[string]string),
+	}
+	templates := make(map[string]StepTemplate)
+	vars := make(map[string]string)
+	for _, inc := range p.Include {
+		incPath, incSource, err := l.resolve(ctx, inc, path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: include %s: %w", source, inc, err)
+		}
+		incDir := ""
+		if inc.Git == "" {
+			incDir = filepath.Dir(incPath)
+		}
+		included, err := l.load(ctx, incPath, incSource, incDir, chain)
+		if err != nil {
+			return nil, err
+		}
+		for name, tmpl := range included.pipeline.Templates {
+			from := included.templateSources[name]
+			if prev, ok := m.templateSources[name]; ok && prev != from {
+				return nil, fmt.Errorf("step template %q is defined in both %s and %s", name, prev, from)
+			}
+			templates[name] = tmpl
+			m.templateSources[name] = from
+		}
+		for key, value := range included.pipeline.Vars {
+			from := included.varSources[key]
+			if prev, ok := m.varSources[key]; ok && prev != from && vars[key] != value {
+				return nil, fmt.Errorf("var %s is set to different values in %s and %s", key, prev, from)
+			}
+			vars[key] = value
+			m.varSources[key] = from
+		}
+	}
+
+	// the manifest's own templates must not clash with included ones, its own vars override them
+	for name, tmpl := range p.Templates {
+		if prev, ok := m.templateSources[name]; ok {
+			return nil, fmt.Errorf("step template %q is defined in both %s and %s", name, prev, source)
+		}
+		templates[name] = tmpl
+		m.templateSources[name] = source
+	}
+	for key, value := range p.Vars {
+		vars[key] = value
+		m.varSources[key] = source
+	}
+
+	if len(templates) > 0 {
+		p.Templates = templates
+	}
+	if len(vars) > 0 {
+		p.Vars = vars
+	}
+	p.Include = nil
+
+	return m, nil
+}
+
+// resolve returns the local path of the included manifest and its source for error messages. Git includes are
+// cloned on first use.
+func (l *manifestLoader) resolve(ctx context.Context, inc Include, including string) (string, string, error) {
+	if inc.Path == "" {
+		return "", "", fmt.Errorf("include must have a path")
+	}
+	if inc.Git == "" {
+		if inc.Ref != "" {
+			return "", "", fmt.Errorf("ref can only be used with git")
+		}
+		path := inc.Path
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(filepath.Dir(including), path)
+		}
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return "", "", err
+		}
+		return abs, abs, nil
+	}
+
+	if filepath.IsAbs(inc.Path) || strings.HasPrefix(filepath.Clean(inc.Path), "..") {
+		return "", "", fmt.Errorf("path must be relative to the root of the repository")
+	}
+
+	key := inc.Git + "@" + inc.Ref
+	dir, ok := l.checkouts[key]
+	if !ok {
+		var err error
+		if dir, err = l.checkout(ctx, inc); err != nil {
+			return "", "", err
+		}
+		l.checkouts[key] = dir
+	}
+
+	return filepath.Join(dir, inc.Path), inc.String(), nil
+}
+
+// checkout clones the repository of a git include into a temporary directory and checks out its ref.
+func (l *manifestLoader) checkout(ctx context.Context, inc Include) (string, error) {
+	opts, err := l.cloneOptions(inc.Git)
+	if err != nil {
+		return "", err
+	}
+
+	dir, err := os.MkdirTemp(l.cfg.TempDir, "metamorph-include-")
+	if err != nil {
+		return "", err
+	}
+
+	opts.Destination = dir
+	if err := git.CloneContext(ctx, opts); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	if inc.Ref != "" {
+		if err := git.CheckoutRevision(dir, inc.Ref); err != nil {
+			os.RemoveAll(dir)
+			return "", err
+		}
+	}
+
+	return dir, nil
+}
+
+// cloneOptions returns the options to clone the repository at url. Repositories hosted on the SCM platform are cloned
+// with the credentials and CA bundle of the platform, like the target repositories; the credentials are never sent to
+// other hosts.
+func (l *manifestLoader) cloneOptions(url string) (git.CloneOptions, error) {
+	opts := git.CloneOptions{URL: url}
+	if l.cfg.Platform == "" {
+		return opts, nil
+	}
+
+	if l.platform == nil {
+		pt, err := scm.ParsePlatformType(l.cfg.Platform)
+		if err != nil {
+			return opts, err
+		}
+		if l.platform, err = scm.NewPlatform(pt, l.cfg); err != nil {
+			return opts, err
+		}
+	}
+	if !sameHost(url, l.platform.CloneURL("")) {
+		return opts, nil
+	}
+
+	auth, err := l.platform.Auth()
+	if err != nil {
+		return opts, err
+	}
+	opts.Auth = auth
+	opts.CABundle = l.platform.CABundle()
+	return opts, nil
+}
+
+// sameHost returns true if both git URLs, in URL or scp-like form, point to the same host.
+func sameHost(a, b string) bool {
+	ea, err := transport.NewEndpoint(a)
+	if err != nil {
+		return false
+	}
+	eb, err := transport.NewEndpoint(b)
+	if err != nil {
+		return false
+	}
+	return ea.Protocol != "file" && ea.Host == eb.Host
+}
+
+// checkIncludable returns an error if the manifest sets keys that are only allowed in the top level manifest.
+func checkIncludable(data string) error {
+	var doc map[string]yaml.Node
+	if err := yaml.Unmarshal([]byte(data), &doc); err != nil {
+		return err
+	}
+	invalid := make([]string, 0)
+	for key := range doc {
+		if !contains(includableKeys, key) {
+			invalid = append(invalid, key)
+		}
+	}
+	if len(invalid) > 0 {
+		sort.Strings(invalid)
+		return fmt.Errorf("included manifests can only set %s, found %s",
+			strings.Join(includableKeys, ", "), strings.Join(invalid, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,259 @@
+package pipeline
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/stretchr/testify/require"
+
+	"github.com/brightfame/metamorph/internal/config"
+)
+
+func TestLoadManifestFileIncludes(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	writeManifest(t, dir, "lib/common.yaml", `include:
+  - node.yaml
+vars:
+  REGISTRY: registry.example.com
+templates:
+  clean:
+    step:
+      image: alpine
+      command: git clean -fdx
+`)
+	writeManifest(t, dir, "lib/node.yaml", `vars:
+  NODE_VERSION: "20"
+templates:
+  yarn:
+    params:
+      args: {}
+    step:
+      image: "{{ .Vars.REGISTRY }}/node:{{ .Vars.NODE_VERSION }}"
+      command: yarn {{ .Params.args }}
+`)
+	writeManifest(t, dir, "manifest.yaml", `include:
+  - lib/common.yaml
+vars:
+  NODE_VERSION: "22"
+steps:
+  - uses: clean
+  - name: install
+    uses: yarn
+    with:
+      args: install
+`)
+
+	p, err := LoadManifestFile(&config.Config{}, filepath.Join(dir, "manifest.yaml"))
+	require.NoError(t, err)
+	require.Empty(t, p.Include)
+	require.Equal(t, map[string]string{"REGISTRY": "registry.example.com", "NODE_VERSION": "22"}, p.Vars)
+	require.Len(t, p.Templates, 2)
+	require.Equal(t, "clean", p.Steps[0].Name)
+	require.Equal(t, "alpine", p.Steps[0].Image)
+	require.Equal(t, "install", p.Steps[1].Name)
+	require.Equal(t, map[string]string{"args": "install"}, p.Steps[1].Params())
+}
+
+func TestLoadManifestFileIncludeErrors(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name  string
+		files map[string]string
+		err   string
+	}{
+		{
+			name: "cycle",
+			files: map[string]string{
+				"a.yaml": "include: [b.yaml]\n",
+				"b.yaml": "include: [a.yaml]\n",
+			},
+			err: "include cycle:",
+		},
+		{
+			name: "template conflict",
+			files: map[string]string{
+				"a.yaml": "templates:\n  clean:\n    step:\n      image: alpine\n",
+			},
+			err: `step template "clean" is defined in both`,
+		},
+		{
+			name: "var conflict",
+			files: map[string]string{
+				"a.yaml": "vars:\n  NODE_VERSION: \"20\"\n",
+				"b.yaml": "vars:\n  NODE_VERSION: \"22\"\n",
+			},
+			err: "var NODE_VERSION is set to different values in",
+		},
+		{
+			name: "steps in include",
+			files: map[string]string{
+				"a.yaml": "steps:\n  - name: test\n    image: alpine\n    command: true\n",
+			},
+			err: "included manifests can only set include, vars, templates, found steps",
+		},
+		{
+			name:  "missing include",
+			files: map[string]string{},
+			err:   "no such file or directory",
+		},
+	}
+
+	for _, testCase := range testCases {
+		// The following is necessary to make sure testCase's values don't
+		// get updated due to concurrency within the scope of t.Run(..) below
+		testCase := testCase
+
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			writeManifest(t, dir, "manifest.yaml", `include: [a.yaml, b.yaml]
+templates:
+  clean:
+    step:
+      image: alpine
+      command: git clean -fdx
+steps:
+  - uses: clean
+`)
+			for name, content := range testCase.files {
+				writeManifest(t, dir, name, content)
+			}
+			if _, ok := testCase.files["b.yaml"]; !ok && len(testCase.files) > 0 {
+				writeManifest(t, dir, "b.yaml", "vars: {}\n")
+			}
+
+			_, err := LoadManifestFile(&config.Config{}, filepath.Join(dir, "manifest.yaml"))
+			require.ErrorContains(t, err, testCase.err)
+		})
+	}
+}
+
+func TestLoadManifestFileIncludeCycleToRoot(t *testing.T) {
+	dir := t.TempDir()
+	writeManifest(t, dir, "manifest.yaml", `include: [lib/a.yaml]
+steps:
+  - name: test
+    image: alpine
+    command: "true"
+`)
+	writeManifest(t, filepath.Join(dir, "lib"), "a.yaml", "include: [../manifest.yaml]\n")
+
+	// the root manifest is loaded by a relative path, but included by an absolute one
+	t.Chdir(dir)
+	_, err := LoadManifestFile(&config.Config{}, "manifest.yaml")
+	require.ErrorContains(t, err, "include cycle: "+filepath.Join(dir, "manifest.yaml")+" -> "+filepath.Join(dir, "lib", "a.yaml")+" -> "+filepath.Join(dir, "manifest.yaml"))
+}
+
+func TestLoadManifestFileGitInclude(t *testing.T) {
+	t.Parallel()
+
+	// the library repo has the template at the v1 tag and a breaking change on main
+	libPath := t.TempDir()
+	lib, err := git.PlainInitWithOptions(libPath, &git.PlainInitOptions{
+		InitOptions: git.InitOptions{DefaultBranch: plumbing.Main},
+	})
+	require.NoError(t, err)
+	wt, err := lib.Worktree()
+	require.NoError(t, err)
+
+	commit := func(content string) plumbing.Hash {
+		writeManifest(t, libPath, "steps/go.yaml", content)
+		_, err := wt.Add("steps/go.yaml")
+		require.NoError(t, err)
+		hash, err := wt.Commit("Update go steps", &git.CommitOptions{
+			Author: &object.Signature{Name: "Test", Email: "test@example.com", When: time.Now()},
+		})
+		require.NoError(t, err)
+		return hash
+	}
+	v1 := commit("templates:\n  go-test:\n    step:\n      image: golang:1.23\n      command: go test ./...\n")
+	_, err = lib.CreateTag("v1", v1, nil)
+	require.NoError(t, err)
+	commit("templates:\n  go-test:\n    step:\n      image: golang:1.24\n      command: go test ./...\n")
+
+	dir := t.TempDir()
+	writeManifest(t, dir, "manifest.yaml", `include:
+  - git: `+libPath+`
+    ref: v1
+    path: steps/go.yaml
+steps:
+  - uses: go-test
+`)
+	p, err := LoadManifestFile(&config.Config{}, filepath.Join(dir, "manifest.yaml"))
+	require.NoError(t, err)
+	require.Equal(t, "golang:1.23", p.Steps[0].Image)
+
+	writeManifest(t, dir, "manifest.yaml", `include:
+  - git: `+libPath+`
+    path: steps/go.yaml
+steps:
+  - uses: go-test
+`)
+	p, err = LoadManifestFile(&config.Config{}, filepath.Join(dir, "manifest.yaml"))
+	require.NoError(t, err)
+	require.Equal(t, "golang:1.24", p.Steps[0].Image)
+
+	writeManifest(t, dir, "manifest.yaml", `include:
+  - git: `+libPath+`
+    ref: v2
+    path: steps/go.yaml
+steps:
+  - uses: go-test
+`)
+	_, err = LoadManifestFile(&config.Config{}, filepath.Join(dir, "manifest.yaml"))
+	require.ErrorContains(t, err, "unknown revision v2")
+}
+
+// writeManifest writes content to the file at name relative to dir, creating the parent directories.
+func writeManifest(t *testing.T, dir, name, content string) {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+}
+
+func TestGitIncludeCloneOptions(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+	caPath := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	require.NoError(t, os.WriteFile(caPath, caPEM, 0o600))
+
+	l := newManifestLoader(&config.Config{
+		Platform:           "gitlab",
+		PlatformAuthConfig: config.PlatformAuthConfig{Password: "glpat-secret"},
+		Platforms: map[string]config.PlatformEndpointConfig{
+			"gitlab": {BaseURL: "https://gitlab.example.com", CABundle: caPath},
+		},
+	})
+
+	// includes from the platform use its credentials and CA bundle
+	opts, err := l.cloneOptions("https://gitlab.example.com/platform/manifests.git")
+	require.NoError(t, err)
+	require.Equal(t, &githttp.BasicAuth{Username: "oauth2", Password: "glpat-secret"}, opts.Auth)
+	require.Equal(t, caPEM, opts.CABundle)
+
+	// the credentials are never sent to other hosts
+	for _, url := range []string{"https://github.com/acme/manifests.git", "git@github.com:acme/manifests.git", "/srv/git/manifests.git"} {
+		opts, err = l.cloneOptions(url)
+		require.NoError(t, err)
+		require.Nil(t, opts.Auth, url)
+		require.Nil(t, opts.CABundle, url)
+	}
+}
@@ -0,0 +1,169 @@
+package pipeline
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// StepTemplate is a named, parameterized step that steps reference with uses. Its fields can refer to the
+// parameters with "{{ .Params.name }}".
+type StepTemplate struct {
+	// Params are the parameters of the template, keyed by name.
+	Params map[string]Param `yaml:"params,omitempty"`
+	// Step is the step the template expands to. Fields set on the step that uses the template take precedence.
+	Step Step `yaml:"step"`
+}
+
+// Param is a parameter of a step template. Parameters without a default are required.
+type Param struct {
+	Description string  `yaml:"description,omitempty"`
+	Default     *string `yaml:"default,omitempty"`
+}
+
+// Params returns the parameters of the step template the step uses, if any.
+func (s *Step) Params() map[string]string {
+	return s.params
+}
+
+// expandUses replaces every step that uses a template with the expanded template.
+func (p *Pipeline) expandUses() error {
+	for i, step := range p.Steps {
+		if step.Uses == "" {
+			continue
+		}
+		expanded, err := p.expandStep(step, nil)
+		if err != nil {
+			return fmt.Errorf("step %s: %w", stepName(step, i), err)
+		}
+		p.Steps[i] = expanded
+	}
+	return nil
+}
+
+// expandStep expands the template the step uses. Templates may use other templates; chain holds the templates that
+// are being expanded to detect cycles.
+func (p *Pipeline) expandStep(step Step, chain []string) (Step, error) {
+	for _, name := range chain {
+		if name == step.Uses {
+			return step, fmt.Errorf("step templates form a cycle: %s -> %s", strings.Join(chain, " -> "), step.Uses)
+		}
+	}
+
+	tmpl, ok := p.Templates[step.Uses]
+	if !ok {
+		return step, fmt.Errorf("uses unknown step template %q", step.Uses)
+	}
+
+	params, err := tmpl.resolveParams(step.Uses, step.With)
+	if err != nil {
+		return step, err
+	}
+
+	base := tmpl.Step
+	if base.Uses != "" {
+		if base, err = p.expandStep(base, append(chain, step.Uses)); err != nil {
+			return step, err
+		}
+	}
+
+	expanded := mergeSteps(base, step)
+	if expanded.Name == "" {
+		expanded.Name = step.Uses
+	}
+	expanded.Uses = ""
+	expanded.With = nil
+	expanded.params = mergeMaps(base.params, params)
+
+	return expanded, nil
+}
+
+// resolveParams checks the arguments against the parameters of the template and applies the defaults.
+func (t StepTemplate) resolveParams(name string, with map[string]string) (map[string]string, error) {
+	for key := range with {
+		if _, ok := t.Params[key]; !ok {
+			return nil, fmt.Errorf("step template %s has no parameter %q", name, key)
+		}
+	}
+
+	params := make(map[string]string, len(t.Params))
+	missing := make([]string, 0)
+	for key, param := range t.Params {
+		if value, ok := with[key]; ok {
+			params[key] = value
+		} else if param.Default != nil {
+			params[key] = *param.Default
+		} else {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, fmt.Errorf("step template %s requires the parameters %s", name, strings.Join(missing, ", "))
+	}
+
+	return params, nil
+}
+
+// mergeSteps overlays the fields set on override onto base. Environments are merged with override winning.
+func mergeSteps(base, override Step) Step {
+	merged := base
+	if override.Name != "" {
+		merged.Name = override.Name
+	}
+	if override.Executor != "" {
+		merged.Executor = override.Executor
+	}
+	if override.Image != "" {
+		merged.Image = override.Image
+	}
+	// the command forms are mutually exclusive, so a step that sets any of them replaces all of them
+	if override.Command != "" || override.Run != "" || len(override.Args) > 0 {
+		merged.Command = override.Command
+		merged.Run = override.Run
+		merged.Args = override.Args
+	}
+	if override.Shell != "" {
+		merged.Shell = override.Shell
+	}
+	if len(override.Env) > 0 {
+		merged.Env = mergeMaps(base.Env, override.Env)
+	}
+	if override.WorkDir != "" {
+		merged.WorkDir = override.WorkDir
+	}
+	if len(override.Volumes) > 0 {
+		merged.Volumes = override.Volumes
+	}
+	if override.User != "" {
+		merged.User = override.User
+	}
+	if override.Timeout != "" {
+		merged.Timeout = override.Timeout
+	}
+	if override.Retry != (RetryPolicy{}) {
+		merged.Retry = override.Retry
+	}
+	if override.If != "" {
+		merged.If = override.If
+	}
+	if override.ContinueOnError {
+		merged.ContinueOnError = true
+	}
+	return merged
+}
+
+// mergeMaps returns a copy of base with the entries of override added. It returns nil if both are empty.
+func mergeMaps(base, override map[string]string) map[string]string {
+	if len(base) == 0 && len(override) == 0 {
+		return nil
+	}
+	merged := make(map[string]string, len(base)+len(override))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range override {
+		merged[k] = v
+	}
+	return merged
+}
@@ -0,0 +1,104 @@
+package pipeline
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpandUses(t *testing.T) {
+	t.Parallel()
+
+	manifest := `templates:
+  go-test:
+    params:
+      version:
+        description: Go version to test with
+      packages:
+        default: ./...
+    step:
+      name: run tests
+      image: golang:{{ .Params.version }}
+      command: go test {{ .Params.packages }}
+      environment:
+        CGO_ENABLED: "0"
+        GOFLAGS: -mod=mod
+      timeout: 10m
+steps:
+  - uses: go-test
+    with:
+      version: "1.24"
+  - name: run tests on 1.23
+    uses: go-test
+    if: params.version == '1.23'
+    with:
+      version: "1.23"
+      packages: ./pkg/...
+    environment:
+      GOFLAGS: -mod=vendor
+`
+	p := &Pipeline{}
+	require.NoError(t, parseFile(p, manifest))
+	require.Len(t, p.Steps, 2)
+
+	first := p.Steps[0]
+	require.Equal(t, "run tests", first.Name)
+	require.Equal(t, "10m", first.Timeout)
+	require.Equal(t, map[string]string{"version": "1.24", "packages": "./..."}, first.Params())
+
+	second := p.Steps[1]
+	require.Equal(t, "run tests on 1.23", second.Name)
+	require.Empty(t, second.Uses)
+	require.Equal(t, map[string]string{"CGO_ENABLED": "0", "GOFLAGS": "-mod=vendor"}, second.Env)
+
+	ctx := &ExpressionContext{Params: second.Params()}
+	run, err := second.Condition().Eval(ctx)
+	require.NoError(t, err)
+	require.True(t, run)
+
+	rendered, err := second.Render(ctx, true)
+	require.NoError(t, err)
+	require.Equal(t, []string{"/bin/sh", "-e", "-c", "go test ./pkg/..."}, rendered.Commands())
+}
+
+func TestExpandUsesErrors(t *testing.T) {
+	t.Parallel()
+
+	templates := `templates:
+  lint:
+    params:
+      config: {}
+    step:
+      image: golangci/golangci-lint
+      command: golangci-lint run -c {{ .Params.config }}
+  a:
+    step:
+      uses: b
+  b:
+    step:
+      uses: a
+`
+	testCases := []struct {
+		name  string
+		steps string
+		err   string
+	}{
+		{"unknown template", "  - uses: fmt\n", `step 0: uses unknown step template "fmt"`},
+		{"missing param", "  - uses: lint\n", "step 0: step template lint requires the parameters config"},
+		{"unknown param", "  - uses: lint\n    with:\n      config: x\n      fix: \"true\"\n", `step template lint has no parameter "fix"`},
+		{"cycle", "  - name: loop\n    uses: a\n", "step loop: step templates form a cycle: a -> b -> a"},
+	}
+
+	for _, testCase := range testCases {
+		// The following is necessary to make sure testCase's values don't
+		// get updated due to concurrency within the scope of t.Run(..) below
+		testCase := testCase
+
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := parseFile(&Pipeline{}, templates+"steps:\n"+testCase.steps)
+			require.ErrorContains(t, err, testCase.err)
+		})
+	}
+}
@@ -0,0 +1,526 @@
+package pipeline
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/brightfame/metamorph/internal/config"
+)
+
+// Schema is the JSON Schema of the manifest format.
+//
+//go:embed manifest.schema.json
+var Schema []byte
+
+// Problem is an issue found in a manifest. Line and Column are 1-based and zero when the problem has no position.
+type Problem struct {
+	File    string `json:"file"`
+	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+// String formats the problem like compiler errors, e.g. "manifest.yaml:12:5: unknown key \"imge\" in steps[1]".
+func (p Problem) String() string {
+	switch {
+	case p.Line > 0 && p.Column > 0:
+		return fmt.Sprintf("%s:%d:%d: %s", p.File, p.Line, p.Column, p.Message)
+	case p.Line > 0:
+		return fmt.Sprintf("%s:%d: %s", p.File, p.Line, p.Message)
+	default:
+		return fmt.Sprintf("%s: %s", p.File, p.Message)
+	}
+}
+
+var (
+	envVarPattern    = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}|\$([A-Za-z_][A-Za-z0-9_]*)`)
+	yamlErrorPattern = regexp.MustCompile(`line (\d+): (.*)`)
+)
+
+// ValidateManifestFile checks the manifest at path and returns all the problems found, positioned by line where
+// possible: unknown keys, values of the wrong type, invalid durations and volumes, duplicate step names, environment
+// variables that aren't set, includes that can't be loaded and, for each step, unknown step templates and parameters,
+// invalid commands, missing images, executor mismatches, templates that don't parse and invalid if expressions. When
+// none of these are found, the manifest is also loaded like LoadManifestFile does and a load error is reported as a
+// problem. The error is only set if the file can't be read.
+func ValidateManifestFile(cfg *config.Config, path string) ([]Problem, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	vars := map[string]string{
+		"GITLAB_ORG": cfg.PlatformOrg,
+	}
+	problems := unresolvedEnvVars(path, data, vars)
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(expandEnvVars(data, vars)), &doc); err != nil {
+		return append(problems, yamlProblems(path, err)...), nil
+	}
+	if len(doc.Content) == 0 {
+		return append(problems, Problem{File: path, Message: "manifest is empty"}), nil
+	}
+
+	root := doc.Content[0]
+	structural := checkKeys(path, root, reflect.TypeOf(Pipeline{}), "")
+	structural = append(structural, checkSteps(path, root)...)
+	if err := root.Decode(&Pipeline{}); err != nil {
+		structural = append(structural, yamlProblems(path, err)...)
+	}
+	structural = append(structural, checkStepSemantics(cfg, path, root)...)
+	problems = append(problems, structural...)
+	sort.SliceStable(problems, func(i, j int) bool {
+		if problems[i].Line != problems[j].Line {
+			return problems[i].Line < problems[j].Line
+		}
+		return problems[i].Column < problems[j].Column
+	})
+
+	// the loader stops at the first problem, so it only runs for the checks above don't cover, like the templates of
+	// the change request
+	if len(structural) == 0 {
+		if _, err := LoadManifestFile(cfg, path); err != nil {
+			problems = append(problems, Problem{File: path, Message: err.Error()})
+		}
+	}
+
+	return problems, nil
+}
+
+// unresolvedEnvVars reports the $VAR and ${VAR} references that expand to nothing because the variable isn't set.
+// Variables that are set to an empty string count as unset. References inside Go template actions are template
+// variables, which aren't expanded.
+func unresolvedEnvVars(path string, data []byte, vars map[string]string) []Problem {
+	actions := templateActions(string(data))
+	inAction := func(offset int) bool {
+		for _, action := range actions {
+			if offset >= action[0] && offset < action[1] {
+				return true
+			}
+		}
+		return false
+	}
+
+	problems := make([]Problem, 0)
+	lineStart := 0
+	for i, line := range strings.Split(string(data), "\n") {
+		offset := lineStart
+		lineStart += len(line) + 1
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		for _, match := range envVarPattern.FindAllStringSubmatchIndex(line, -1) {
+			if inAction(offset + match[0]) {
+				continue
+			}
+			// the first group matches ${VAR}, the second $VAR
+			var name string
+			if match[2] >= 0 {
+				name = line[match[2]:match[3]]
+			} else {
+				name = line[match[4]:match[5]]
+			}
+			if vars[name] != "" || os.Getenv(name) != "" || strings.HasPrefix(name, "METAMORPH_") {
+				continue
+			}
+			problems = append(problems, Problem{
+				File:    path,
+				Line:    i + 1,
+				Column:  match[0] + 1,
+				Message: fmt.Sprintf("environment variable %s is not set", name),
+			})
+		}
+	}
+	return problems
+}
+
+// yamlProblems turns the line numbers in YAML decoding errors into positions.
+func yamlProblems(path string, err error) []Problem {
+	var typeErr *yaml.TypeError
+	messages := []string{err.Error()}
+	if errors.As(err, &typeErr) {
+		messages = typeErr.Errors
+	}
+
+	problems := make([]Problem, 0, len(messages))
+	for _, msg := range messages {
+		problem := Problem{File: path, Message: msg}
+		if m := yamlErrorPattern.FindStringSubmatch(msg); m != nil {
+			problem.Line, _ = strconv.Atoi(m[1])
+			problem.Message = m[2]
+		}
+		problems = append(problems, problem)
+	}
+	return problems
+}
+
+// checkKeys reports the mapping keys in node that have no matching field in t. Values whose type doesn't match are
+// left to the decoder to report.
+func checkKeys(path string, node *yaml.Node, t reflect.Type, at string) []Problem {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	problems := make([]Problem, 0)
+	switch t.Kind() {
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			// types with their own decoding, like repos, accept a shorthand scalar
+			return problems
+		}
+		fields := yamlFields(t)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			field, ok := fields[key.Value]
+			if !ok {
+				problems = append(problems, Problem{
+					File:    path,
+					Line:    key.Line,
+					Column:  key.Column,
+					Message: fmt.Sprintf("unknown key %q%s", key.Value, describePath(at)),
+				})
+				continue
+			}
+			problems = append(problems, checkKeys(path, value, field.Type, joinPath(at, key.Value))...)
+		}
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			return problems
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			problems = append(problems, checkKeys(path, node.Content[i+1], t.Elem(), joinPath(at, node.Content[i].Value))...)
+		}
+	case reflect.Slice:
+		if node.Kind != yaml.SequenceNode {
+			return problems
+		}
+		for i, item := range node.Content {
+			problems = append(problems, checkKeys(path, item, t.Elem(), fmt.Sprintf("%s[%d]", at, i))...)
+		}
+	}
+	return problems
+}
+
+// yamlFields returns the exported fields of t keyed by their YAML name.
+func yamlFields(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		fields[name] = field
+	}
+	return fields
+}
+
+// checkSteps reports invalid durations and volumes in the steps and step templates and duplicate step names.
+func checkSteps(path string, root *yaml.Node) []Problem {
+	problems := make([]Problem, 0)
+
+	names := make(map[string]*yaml.Node)
+	if steps := mappingValue(root, "steps"); steps != nil && steps.Kind == yaml.SequenceNode {
+		for i, step := range steps.Content {
+			problems = append(problems, checkStep(path, step, fmt.Sprintf("steps[%d]", i))...)
+
+			name := mappingValue(step, "name")
+			if name == nil || name.Value == "" {
+				continue
+			}
+			if first, ok := names[name.Value]; ok {
+				problems = append(problems, Problem{
+					File:    path,
+					Line:    name.Line,
+					Column:  name.Column,
+					Message: fmt.Sprintf("step name %s is already used on line %d", name.Value, first.Line),
+				})
+				continue
+			}
+			names[name.Value] = name
+		}
+	}
+
+	if templates := mappingValue(root, "templates"); templates != nil && templates.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(templates.Content); i += 2 {
+			if step := mappingValue(templates.Content[i+1], "step"); step != nil {
+				problems = append(problems, checkStep(path, step, "templates."+templates.Content[i].Value+".step")...)
+			}
+		}
+	}
+
+	return problems
+}
+
+// checkStep reports the invalid durations and volumes of a single step.
+func checkStep(path string, step *yaml.Node, at string) []Problem {
+	problems := make([]Problem, 0)
+	invalid := func(node *yaml.Node, format string, args ...any) {
+		problems = append(problems, Problem{
+			File:    path,
+			Line:    node.Line,
+			Column:  node.Column,
+			Message: fmt.Sprintf(format, args...) + describePath(at),
+		})
+	}
+
+	if timeout := mappingValue(step, "timeout"); timeout != nil {
+		if _, err := parseDuration(timeout.Value); err != nil {
+			invalid(timeout, "invalid timeout: %v", err)
+		}
+	}
+	if interval := mappingValue(mappingValue(step, "retry"), "interval"); interval != nil {
+		if _, err := parseDuration(interval.Value); err != nil {
+			invalid(interval, "invalid retry interval: %v", err)
+		}
+	}
+	if volumes := mappingValue(step, "volumes"); volumes != nil && volumes.Kind == yaml.SequenceNode {
+		for _, volume := range volumes.Content {
+			if _, err := ParseVolume(volume.Value); err != nil {
+				invalid(volume, "%v", err)
+			}
+		}
+	}
+
+	return problems
+}
+
+// checkStepSemantics reports the problems loading the manifest would stop at for each of its steps, positioned at the
+// field of the step they are about. Steps that use a step template are checked after expanding it, with the templates
+// of the manifest and its includes.
+func checkStepSemantics(cfg *config.Config, path string, root *yaml.Node) []Problem {
+	templates, problems := includedTemplates(cfg, path, root)
+	if node := mappingValue(root, "templates"); node != nil {
+		local := make(map[string]StepTemplate)
+		// values of the wrong type are reported by the decoder
+		_ = node.Decode(&local)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i]
+			if from, ok := templates.sources[key.Value]; ok {
+				problems = append(problems, Problem{
+					File:    path,
+					Line:    key.Line,
+					Column:  key.Column,
+					Message: fmt.Sprintf("step template %q is also defined in %s", key.Value, from),
+				})
+			}
+		}
+		for name, tmpl := range local {
+			templates.templates[name] = tmpl
+		}
+	}
+
+	steps := mappingValue(root, "steps")
+	if steps == nil || steps.Kind != yaml.SequenceNode {
+		return problems
+	}
+
+	p := &Pipeline{cfg: cfg, Templates: templates.templates}
+	previous := make([]string, 0, len(steps.Content))
+	for i, node := range steps.Content {
+		var step Step
+		_ = node.Decode(&step)
+		found, name := checkStepSemantic(path, p, node, step, previous, fmt.Sprintf("steps[%d]", i))
+		problems = append(problems, found...)
+		if name != "" {
+			previous = append(previous, name)
+		}
+	}
+	return problems
+}
+
+// checkStepSemantic reports the problems of a single step like Validate does, and returns the name of the step after
+// expanding its step template.
+func checkStepSemantic(path string, p *Pipeline, node *yaml.Node, step Step, previous []string, at string) ([]Problem, string) {
+	problems := make([]Problem, 0)
+	invalid := func(node *yaml.Node, format string, args ...any) {
+		problems = append(problems, Problem{
+			File:    path,
+			Line:    node.Line,
+			Column:  node.Column,
+			Message: fmt.Sprintf(format, args...) + describePath(at),
+		})
+	}
+	// fields that aren't set on the step come from its step template, if any, or are missing from the step
+	field := func(keys ...string) *yaml.Node {
+		for _, key := range append(keys, "uses") {
+			if value := mappingValue(node, key); value != nil {
+				return value
+			}
+		}
+		return node
+	}
+
+	if step.Uses != "" {
+		expanded, err := p.expandStep(step, nil)
+		if err != nil {
+			invalid(field("with"), "%v", err)
+			return problems, step.Name
+		}
+		step = expanded
+	}
+
+	if _, err := step.buildCommand(); err != nil {
+		invalid(field("command", "run", "args", "shell"), "%v", err)
+	}
+
+	if et, err := p.StepExecutor(step); err != nil {
+		invalid(field("executor"), "%v", err)
+	} else if et == LocalExecutor {
+		if len(step.Volumes) > 0 {
+			invalid(field("volumes"), "volumes can't be used with the local executor")
+		}
+		if step.User != "" {
+			invalid(field("user"), "user can't be used with the local executor")
+		}
+	} else if step.Image == "" {
+		invalid(field("image"), "must specify a Docker image")
+	}
+
+	templateFields := map[string]string{"command": step.Command, "run": step.Run}
+	for name, text := range templateFields {
+		if _, err := parseTemplate(name, text, false); err != nil {
+			invalid(field(name), "%v", err)
+		}
+	}
+	for i, arg := range step.Args {
+		name := fmt.Sprintf("args[%d]", i)
+		if _, err := parseTemplate(name, arg, false); err != nil {
+			argNode := field("args")
+			if argNode.Kind == yaml.SequenceNode && i < len(argNode.Content) {
+				argNode = argNode.Content[i]
+			}
+			invalid(argNode, "%v", err)
+		}
+	}
+	for key, value := range step.Env {
+		if _, err := parseTemplate("environment."+key, value, false); err != nil {
+			valueNode := field("environment")
+			if v := mappingValue(valueNode, key); v != nil {
+				valueNode = v
+			}
+			invalid(valueNode, "%v", err)
+		}
+	}
+
+	if step.If != "" {
+		if _, err := ParseExpression(step.If, previous); err != nil {
+			invalid(field("if"), "invalid if expression: %v", err)
+		}
+	}
+
+	return problems, step.Name
+}
+
+// templateSet is a set of step templates together with the manifests they were defined in.
+type templateSet struct {
+	templates map[string]StepTemplate
+	sources   map[string]string
+}
+
+// includedTemplates loads the manifests the root manifest includes like the loader does and returns the step
+// templates they define. Includes that can't be loaded are reported at their position.
+func includedTemplates(cfg *config.Config, path string, root *yaml.Node) (templateSet, []Problem) {
+	set := templateSet{
+		templates: make(map[string]StepTemplate),
+		sources:   make(map[string]string),
+	}
+	problems := make([]Problem, 0)
+
+	includes := mappingValue(root, "include")
+	if includes == nil || includes.Kind != yaml.SequenceNode {
+		return set, problems
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return set, append(problems, Problem{File: path, Message: err.Error()})
+	}
+
+	loader := newManifestLoader(cfg)
+	defer loader.cleanup()
+
+	for _, node := range includes.Content {
+		invalid := func(format string, args ...any) {
+			problems = append(problems, Problem{
+				File:    path,
+				Line:    node.Line,
+				Column:  node.Column,
+				Message: fmt.Sprintf(format, args...),
+			})
+		}
+
+		var inc Include
+		if err := node.Decode(&inc); err != nil {
+			continue
+		}
+		incPath, incSource, err := loader.resolve(context.Background(), inc, abs)
+		if err != nil {
+			invalid("include %s: %v", inc, err)
+			continue
+		}
+		incDir := ""
+		if inc.Git == "" {
+			incDir = filepath.Dir(incPath)
+		}
+		included, err := loader.load(context.Background(), incPath, incSource, incDir, []string{abs})
+		if err != nil {
+			invalid("include %s: %v", inc, err)
+			continue
+		}
+		for name, tmpl := range included.pipeline.Templates {
+			from := included.templateSources[name]
+			if prev, ok := set.sources[name]; ok && prev != from {
+				invalid("step template %q is defined in both %s and %s", name, prev, from)
+				continue
+			}
+			set.templates[name] = tmpl
+			set.sources[name] = from
+		}
+	}
+	return set, problems
+}
+
+// mappingValue returns the value of key in a mapping node, or nil.
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func joinPath(at, key string) string {
+	if at == "" {
+		return key
+	}
+	return at + "." + key
+}
+
+func describePath(at string) string {
+	if at == "" {
+		return ""
+	}
+	return " in " + at
+}
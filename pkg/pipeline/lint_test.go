@@ -0,0 +1,208 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/brightfame/metamorph/internal/config"
+)
+
+func TestValidateManifestFile(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	writeManifest(t, dir, "manifest.yaml", `name: test
+imgae: alpine
+steps:
+  - name: clean
+    image: alpine
+    command: rm -rf ${METAMORPH_TEST_UNSET_VAR}/node_modules
+    timeout: 10 minutes
+    volumes:
+      - /scripts
+  - name: clean
+    image: alpine
+    comand: ls
+    retry:
+      interval: soon
+templates:
+  lint:
+    step:
+      image: golangci/golangci-lint
+      volumes:
+        - ":/cache"
+`)
+	path := filepath.Join(dir, "manifest.yaml")
+
+	problems, err := ValidateManifestFile(&config.Config{}, path)
+	require.NoError(t, err)
+
+	// METAMORPH_ variables are set inside the step containers, so the reference is not reported
+	messages := make([]string, 0, len(problems))
+	for _, problem := range problems {
+		messages = append(messages, problem.String())
+	}
+	require.Equal(t, []string{
+		path + `:2:1: unknown key "imgae"`,
+		path + `:7:14: invalid timeout: time: unknown unit " minutes" in duration "10 minutes" in steps[0]`,
+		path + `:9:9: volume "/scripts" must have the form SOURCE:TARGET[:ro|rw] in steps[0]`,
+		path + `:10:5: must specify one of command, run or args in steps[1]`,
+		path + `:10:11: step name clean is already used on line 4`,
+		path + `:12:5: unknown key "comand" in steps[1]`,
+		path + `:14:17: invalid retry interval: time: invalid duration "soon" in steps[1]`,
+		path + `:20:11: volume ":/cache" must have a source in templates.lint.step`,
+	}, messages)
+}
+
+func TestValidateManifestFileLoadErrors(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	writeManifest(t, dir, "unset.yaml", `steps:
+  - name: test
+    image: alpine
+    command: echo $TEST_VALIDATE_UNSET_VAR
+  - name: org
+    image: alpine
+    command: echo ${GITLAB_ORG}
+  - name: print
+    image: alpine
+    run: echo {{ range $k, $v := .Vars }}{{ $k }}={{ $v }} {{ end }}
+`)
+	problems, err := ValidateManifestFile(&config.Config{}, filepath.Join(dir, "unset.yaml"))
+	require.NoError(t, err)
+	require.Equal(t, []Problem{{
+		File:    filepath.Join(dir, "unset.yaml"),
+		Line:    4,
+		Column:  19,
+		Message: "environment variable TEST_VALIDATE_UNSET_VAR is not set",
+	}, {
+		File:    filepath.Join(dir, "unset.yaml"),
+		Line:    7,
+		Column:  19,
+		Message: "environment variable GITLAB_ORG is not set",
+	}}, problems)
+
+	// the platform org is set by the config
+	problems, err = ValidateManifestFile(&config.Config{PlatformOrg: "backend"}, filepath.Join(dir, "unset.yaml"))
+	require.NoError(t, err)
+	require.Len(t, problems, 1)
+
+	// problems only the loader finds are reported without a position
+	writeManifest(t, dir, "invalid.yaml", `gitlab:
+  branch_name: "{{ .Vars.branch"
+steps:
+  - name: test
+    image: alpine
+    command: echo hello
+`)
+	problems, err = ValidateManifestFile(&config.Config{}, filepath.Join(dir, "invalid.yaml"))
+	require.NoError(t, err)
+	require.Len(t, problems, 1)
+	require.Zero(t, problems[0].Line)
+	require.Contains(t, problems[0].Message, "invalid template in branch_name")
+
+	writeManifest(t, dir, "types.yaml", "name: test\nsteps: clean\n")
+	problems, err = ValidateManifestFile(&config.Config{}, filepath.Join(dir, "types.yaml"))
+	require.NoError(t, err)
+	require.Len(t, problems, 1)
+	require.Equal(t, 2, problems[0].Line)
+	require.Contains(t, problems[0].Message, "cannot unmarshal")
+}
+
+func TestValidateManifestFileStepProblems(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	writeManifest(t, dir, "lib.yaml", `templates:
+  go-lint:
+    params:
+      version: {}
+    step:
+      image: "golangci/golangci-lint:{{ .Params.version }}"
+      run: golangci-lint run
+`)
+	writeManifest(t, dir, "manifest.yaml", `include:
+  - lib.yaml
+  - missing.yaml
+imgae: alpine
+steps:
+  - name: build
+    command: go build ./...
+  - name: test
+    image: golang
+    run: go test {{ .Vars.packages
+    if: steps.deploy.failed
+  - name: lint
+    uses: go-lint
+    with:
+      versoin: v1
+  - name: clean
+    executor: ssh
+    image: alpine
+    args: [rm, -rf, "{{ end }}"]
+  - name: host
+    executor: local
+    user: root
+    run: make
+`)
+	path := filepath.Join(dir, "manifest.yaml")
+
+	problems, err := ValidateManifestFile(&config.Config{}, path)
+	require.NoError(t, err)
+
+	// the problems of every step are reported, even though the manifest also has structural problems
+	messages := make([]string, 0, len(problems))
+	for _, problem := range problems {
+		messages = append(messages, fmt.Sprintf("%d:%d: %s", problem.Line, problem.Column, problem.Message))
+	}
+	require.Len(t, messages, 9)
+	require.Contains(t, messages[0], `3:5: include missing.yaml: open `)
+	require.Equal(t, []string{
+		`4:1: unknown key "imgae"`,
+		`6:5: must specify a Docker image in steps[0]`,
+		`10:10: invalid template in run: template: run:1: unclosed action in steps[1]`,
+		`11:9: invalid if expression: unknown reference steps.deploy.failed, use steps.NAME.outcome|exit_code|changed or steps.NAME.outputs.KEY in steps[1]`,
+		`15:7: step template go-lint has no parameter "versoin" in steps[2]`,
+		`17:15: unknown executor type "ssh", must be container or local in steps[3]`,
+		`19:21: invalid template in args[2]: template: args[2]:1: unexpected {{end}} in steps[3]`,
+		`22:11: user can't be used with the local executor in steps[4]`,
+	}, messages[1:])
+}
+
+func TestSchemaCoversManifestFields(t *testing.T) {
+	t.Parallel()
+
+	var schema struct {
+		Properties map[string]any `json:"properties"`
+		Defs       map[string]struct {
+			Properties map[string]any `json:"properties"`
+		} `json:"$defs"`
+	}
+	require.NoError(t, json.Unmarshal(Schema, &schema))
+
+	keys := func(properties map[string]any) []string {
+		names := make([]string, 0, len(properties))
+		for name := range properties {
+			names = append(names, name)
+		}
+		return names
+	}
+	fields := func(v any) []string {
+		names := make([]string, 0)
+		for name := range yamlFields(reflect.TypeOf(v)) {
+			names = append(names, name)
+		}
+		return names
+	}
+
+	require.ElementsMatch(t, fields(Pipeline{}), keys(schema.Properties))
+	require.ElementsMatch(t, fields(Step{}), keys(schema.Defs["step"].Properties))
+	require.ElementsMatch(t, fields(StepTemplate{}), keys(schema.Defs["stepTemplate"].Properties))
+	require.ElementsMatch(t, fields(Condition{}), keys(schema.Defs["condition"].Properties))
+}
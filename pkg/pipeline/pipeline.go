@@ -1,9 +1,12 @@
 package pipeline
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 
@@ -11,12 +14,29 @@ import (
 )
 
 type Pipeline struct {
-	Name      string   `yaml:"name,omitempty"`
-	WorkDir   string   `yaml:"work_dir,omitempty"`
-	Assignees []string `yaml:"assignees,omitempty"`
-	Reviewers []string `yaml:"reviewers,omitempty"`
-	GitLab    GitLab   `yaml:"gitlab,omitempty"`
-	Steps     []Step   `yaml:"steps"`
+	// Include are manifests whose vars and step templates are merged into this one.
+	Include   []Include `yaml:"include,omitempty"`
+	Name      string    `yaml:"name,omitempty"`
+	WorkDir   string    `yaml:"work_dir,omitempty"`
+	Assignees []string  `yaml:"assignees,omitempty"`
+	Reviewers []string  `yaml:"reviewers,omitempty"`
+	GitLab    GitLab    `yaml:"gitlab,omitempty"`
+	GitHub    GitHub    `yaml:"github,omitempty"`
+	Commit    Commit    `yaml:"commit,omitempty"`
+	// Repos are the repositories the pipeline targets unless repos are given on the command line.
+	Repos []config.Repo `yaml:"repos,omitempty"`
+	// Targets discovers repositories from the SCM platform. Entries in Repos with the same name act as overrides.
+	Targets *config.RepoQuery `yaml:"targets,omitempty"`
+	// Vars are variables available to templates as .Vars, to if expressions as vars.NAME and to steps as
+	// environment variables. The vars of a repo override them.
+	Vars map[string]string `yaml:"vars,omitempty"`
+	// Strict makes templates fail on undefined variables instead of rendering an empty string.
+	Strict bool `yaml:"strict,omitempty"`
+	// When are the preconditions a repo must meet for the steps to run. Repos that don't match are skipped.
+	When []Condition `yaml:"when,omitempty"`
+	// Templates are the named step templates steps can reference with uses.
+	Templates map[string]StepTemplate `yaml:"templates,omitempty"`
+	Steps     []Step                  `yaml:"steps"`
 	cfg       *config.Config
 }
 
@@ -28,22 +48,163 @@ type GitLab struct {
 	Labels                  []string `yaml:"labels"`
 }
 
+type GitHub struct {
+	Org                    string   `yaml:"org"`
+	BranchName             string   `yaml:"branch_name"`
+	PullRequestTitle       string   `yaml:"pull_request_title"`
+	PullRequestDescription string   `yaml:"pull_request_description"`
+	Labels                 []string `yaml:"labels"`
+}
+
+// ChangeRequest is the platform-agnostic view of the gitlab or github block of a manifest.
+type ChangeRequest struct {
+	BranchName  string
+	Title       string
+	Description string
+	Labels      []string
+}
+
+// Commit configures the commit created from the changes made by the pipeline.
+type Commit struct {
+	Message     string `yaml:"message,omitempty"`
+	AuthorName  string `yaml:"author_name,omitempty"`
+	AuthorEmail string `yaml:"author_email,omitempty"`
+}
+
+const (
+	// DefaultCommitAuthorName is the commit author name used when the manifest doesn't specify one.
+	DefaultCommitAuthorName = "MetaMorph"
+	// DefaultCommitAuthorEmail is the commit author email used when the manifest doesn't specify one.
+	DefaultCommitAuthorEmail = "metamorph@brightfame.io"
+)
+
 type Step struct {
-	Name     string            `yaml:"name,omitempty"`
-	Image    string            `yaml:"image,omitempty"`
-	Command  string            `yaml:"command,omitempty"`
-	Env      map[string]string `yaml:"environment,omitempty"`
-	WorkDir  string            `yaml:"work_dir,omitempty"`
-	Volumes  []string          `yaml:"volumes,omitempty"`
-	Timeout  string            `yaml:"timeout,omitempty"`
-	Retry    RetryPolicy       `yaml:"retry,omitempty"`
-	commands []string
+	Name string `yaml:"name,omitempty"`
+	// Uses is the name of the step template the step is based on. The fields set on the step override the template.
+	Uses string `yaml:"uses,omitempty"`
+	// With are the arguments for the parameters of the step template.
+	With map[string]string `yaml:"with,omitempty"`
+	// Executor runs the step: container (default) or local to run it on the host, in which case no image is needed.
+	// When empty, the executor of the run is used.
+	Executor string `yaml:"executor,omitempty"`
+	Image    string `yaml:"image,omitempty"`
+	// Command is a single-line command. It is run with the step's shell, like Run.
+	Command string `yaml:"command,omitempty"`
+	// Run is a script, possibly spanning multiple lines, that is run with the step's shell.
+	Run string `yaml:"run,omitempty"`
+	// Shell is the shell used to run Command or Run: sh (default), bash, or none/exec to execute it directly.
+	Shell string `yaml:"shell,omitempty"`
+	// Args is the exact argv to execute without a shell.
+	Args    []string          `yaml:"args,omitempty"`
+	Env     map[string]string `yaml:"environment,omitempty"`
+	WorkDir string            `yaml:"work_dir,omitempty"`
+	Volumes []string          `yaml:"volumes,omitempty"`
+	// User is the user (and group) the step's container runs as, e.g. "node" or "1000:1000". By default it runs as
+	// the user running metamorph, so the files it writes to the repo keep their owner. Images that need root can set
+	// it to root; the files are handed back to the invoking user after the step.
+	User    string      `yaml:"user,omitempty"`
+	Timeout string      `yaml:"timeout,omitempty"`
+	Retry   RetryPolicy `yaml:"retry,omitempty"`
+	// If is an expression that must be true for the step to run, e.g. "exists('yarn.lock')".
+	If string `yaml:"if,omitempty"`
+	// ContinueOnError lets the pipeline carry on with the next step when this step fails.
+	ContinueOnError bool `yaml:"continue_on_error,omitempty"`
+	commands        []string
+	condition       *Expression
+	params          map[string]string
 }
 
 // RetryPolicy defines the retry behavior for a step
 type RetryPolicy struct {
 	MaxAttempts int    `yaml:"max_attempts" json:"max_attempts"`
 	Interval    string `yaml:"interval" json:"interval"`
+	// Backoff is either "constant" (default) or "exponential", which doubles the interval after every attempt.
+	Backoff string `yaml:"backoff,omitempty" json:"backoff,omitempty"`
+}
+
+const (
+	// ConstantBackoff waits the same interval between every attempt.
+	ConstantBackoff = "constant"
+	// ExponentialBackoff doubles the interval after every attempt.
+	ExponentialBackoff = "exponential"
+)
+
+const (
+	// ContainerExecutor runs a step in a container of the container runtime.
+	ContainerExecutor = "container"
+	// LocalExecutor runs a step as a process on the host.
+	LocalExecutor = "local"
+)
+
+// StepExecutor returns the executor that runs the step: the executor of the step, falling back to the executor of
+// the run and then to the container executor.
+func (p *Pipeline) StepExecutor(step Step) (string, error) {
+	name := step.Executor
+	if name == "" && p.cfg != nil {
+		name = p.cfg.Executor
+	}
+	switch name {
+	case "", ContainerExecutor:
+		return ContainerExecutor, nil
+	case LocalExecutor:
+		return LocalExecutor, nil
+	default:
+		return "", fmt.Errorf("unknown executor type %q, must be %s or %s", name, ContainerExecutor, LocalExecutor)
+	}
+}
+
+// TimeoutDuration returns the parsed step timeout. A zero duration means the step has no timeout.
+func (s *Step) TimeoutDuration() time.Duration {
+	d, _ := parseDuration(s.Timeout)
+	return d
+}
+
+// Attempts returns the maximum number of times the step is executed. It is always at least one.
+func (r RetryPolicy) Attempts() int {
+	if r.MaxAttempts < 1 {
+		return 1
+	}
+	return r.MaxAttempts
+}
+
+// Delay returns how long to wait after the given (1-based) failed attempt before trying again.
+func (r RetryPolicy) Delay(attempt int) time.Duration {
+	interval, _ := parseDuration(r.Interval)
+	if r.Backoff != ExponentialBackoff || attempt < 1 {
+		return interval
+	}
+	return interval * time.Duration(1<<min(attempt-1, 16))
+}
+
+// validate checks the retry policy is well formed.
+func (r RetryPolicy) validate() error {
+	if r.MaxAttempts < 0 {
+		return fmt.Errorf("retry max_attempts must not be negative")
+	}
+	if _, err := parseDuration(r.Interval); err != nil {
+		return fmt.Errorf("invalid retry interval: %w", err)
+	}
+	switch r.Backoff {
+	case "", ConstantBackoff, ExponentialBackoff:
+	default:
+		return fmt.Errorf("unknown retry backoff %q, must be %q or %q", r.Backoff, ConstantBackoff, ExponentialBackoff)
+	}
+	return nil
+}
+
+// parseDuration parses a non-negative duration such as "30s" or "5m". An empty string is a zero duration.
+func parseDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("duration %q must not be negative", s)
+	}
+	return d, nil
 }
 
 // Commands returns the commands for the step
@@ -51,6 +212,116 @@ func (s *Step) Commands() []string {
 	return s.commands
 }
 
+// Condition returns the parsed if expression of the step, or nil if the step always runs.
+func (s *Step) Condition() *Expression {
+	return s.condition
+}
+
+// ChangeRequest returns the change request settings for the configured SCM platform. When the manifest only has a
+// block for another platform, that block is used instead.
+func (p *Pipeline) ChangeRequest() ChangeRequest {
+	gitlab := ChangeRequest{
+		BranchName:  p.GitLab.BranchName,
+		Title:       p.GitLab.MergeRequestTitle,
+		Description: p.GitLab.MergeRequestDescription,
+		Labels:      p.GitLab.Labels,
+	}
+	github := ChangeRequest{
+		BranchName:  p.GitHub.BranchName,
+		Title:       p.GitHub.PullRequestTitle,
+		Description: p.GitHub.PullRequestDescription,
+		Labels:      p.GitHub.Labels,
+	}
+
+	if p.platform() == "github" {
+		if p.GitHub.isZero() {
+			return gitlab
+		}
+		return github
+	}
+	if p.GitLab.isZero() && !p.GitHub.isZero() {
+		return github
+	}
+	return gitlab
+}
+
+// SetBranchName overrides the branch name of the configured SCM platform.
+func (p *Pipeline) SetBranchName(branch string) {
+	if p.platform() == "github" {
+		p.GitHub.BranchName = branch
+		return
+	}
+	p.GitLab.BranchName = branch
+}
+
+// BranchName returns the name of the branch the changes are committed to. It defaults to a branch derived from
+// the pipeline name.
+func (p *Pipeline) BranchName() string {
+	if branch := p.ChangeRequest().BranchName; branch != "" {
+		return branch
+	}
+	return "metamorph/" + slugify(p.Name)
+}
+
+// CommitMessage returns the commit message, falling back to the change request title and then the pipeline name.
+func (p *Pipeline) CommitMessage() string {
+	if p.Commit.Message != "" {
+		return p.Commit.Message
+	}
+	if title := p.ChangeRequest().Title; title != "" {
+		return title
+	}
+	return p.Name
+}
+
+// platform returns the configured SCM platform, if any.
+func (p *Pipeline) platform() string {
+	if p.cfg == nil {
+		return ""
+	}
+	return p.cfg.Platform
+}
+
+func (g GitLab) isZero() bool {
+	return g.BranchName == "" && g.MergeRequestTitle == "" && g.MergeRequestDescription == "" && len(g.Labels) == 0
+}
+
+func (g GitHub) isZero() bool {
+	return g.BranchName == "" && g.PullRequestTitle == "" && g.PullRequestDescription == "" && len(g.Labels) == 0
+}
+
+// CommitAuthor returns the name and email of the commit author.
+func (p *Pipeline) CommitAuthor() (string, string) {
+	name, email := p.Commit.AuthorName, p.Commit.AuthorEmail
+	if name == "" {
+		name = DefaultCommitAuthorName
+	}
+	if email == "" {
+		email = DefaultCommitAuthorEmail
+	}
+	return name, email
+}
+
+// slugify converts s into a lowercase string that is safe to use in a branch name.
+func slugify(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(s) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '.' || r == '_' {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteRune('-')
+			dash = true
+		}
+	}
+	out := strings.TrimRight(b.String(), "-")
+	if out == "" {
+		return "changes"
+	}
+	return out
+}
+
 func New(cfg *config.Config, name string) *Pipeline {
 	return &Pipeline{
 		Name:  name,
@@ -59,38 +330,74 @@ func New(cfg *config.Config, name string) *Pipeline {
 	}
 }
 
-// LoadManifestFile loads the manifest from the given path and returns a pipeline.
-// This also calls Validate() on the pipeline.
+// LoadManifestFile loads the manifest from the given path and returns a pipeline. The manifests it includes are
+// merged into it and the steps that use step templates are expanded. This also calls Validate() on the pipeline.
 func LoadManifestFile(cfg *config.Config, path string) (*Pipeline, error) {
-	p := &Pipeline{}
-	p.cfg = cfg
+	loader := newManifestLoader(cfg)
+	defer loader.cleanup()
 
-	// read the file
-	data, err := os.ReadFile(path)
+	abs, err := filepath.Abs(path)
 	if err != nil {
 		return nil, err
 	}
-
-	// expand vars
-	vars := map[string]string{
-		"GITLAB_ORG": cfg.PlatformOrg,
-	}
-	expanded := expandEnvVars(data, vars)
-	err = parseFile(p, expanded)
+	// includes are resolved to absolute paths, so the root manifest must be too for an include of it to be a cycle
+	m, err := loader.load(context.Background(), abs, abs, filepath.Dir(abs), nil)
 	if err != nil {
 		return nil, err
 	}
+
+	p := m.pipeline
+	p.cfg = cfg
+	if err := p.prepare(); err != nil {
+		return nil, err
+	}
 	return p, nil
 }
 
+// expandEnvVars expands $VAR and ${VAR} using vars and then the environment. Variables that metamorph sets inside
+// the step containers, such as $METAMORPH_OUTPUT, are left for the step's shell to expand. Go template actions are
+// left untouched, so that template variables such as {{ $v := .Vars.X }} survive until the steps are rendered.
 func expandEnvVars(data []byte, vars map[string]string) string {
-	expanded := os.Expand(string(data), func(key string) string {
+	mapping := func(key string) string {
 		if val, ok := vars[key]; ok {
 			return val
 		}
+		if strings.HasPrefix(key, "METAMORPH_") {
+			return "${" + key + "}"
+		}
 		return os.Getenv(key)
-	})
-	return expanded
+	}
+
+	text := string(data)
+	var expanded strings.Builder
+	last := 0
+	for _, action := range templateActions(text) {
+		expanded.WriteString(os.Expand(text[last:action[0]], mapping))
+		expanded.WriteString(text[action[0]:action[1]])
+		last = action[1]
+	}
+	expanded.WriteString(os.Expand(text[last:], mapping))
+	return expanded.String()
+}
+
+// templateActions returns the start and end offsets of the Go template actions, "{{ ... }}", in text. An action that
+// isn't closed extends to the end of the text.
+func templateActions(text string) [][2]int {
+	actions := make([][2]int, 0)
+	for offset := 0; ; {
+		start := strings.Index(text[offset:], "{{")
+		if start < 0 {
+			return actions
+		}
+		start += offset
+		end := strings.Index(text[start+2:], "}}")
+		if end < 0 {
+			return append(actions, [2]int{start, len(text)})
+		}
+		end += start + 4
+		actions = append(actions, [2]int{start, end})
+		offset = end
+	}
 }
 
 func parseFile(p *Pipeline, data string) error {
@@ -99,22 +406,40 @@ func parseFile(p *Pipeline, data string) error {
 	if err != nil {
 		return fmt.Errorf("decode config: %w", err)
 	}
-	//return cfg, err
+	if len(p.Include) > 0 {
+		return fmt.Errorf("include is only supported when loading a manifest file")
+	}
 
-	// parse the yaml file
-	// if err := yaml.NewDecoder(f).Decode(p); err != nil {
-	// 	return fmt.Errorf("decode config: %w", err)
-	// }
+	return p.prepare()
+}
+
+// prepare expands the steps that use step templates, resolves their commands and validates the pipeline.
+func (p *Pipeline) prepare() error {
+	if err := p.expandUses(); err != nil {
+		return err
+	}
 
-	// we map the command in each step to a slice of strings
-	// so that we can pass it to the container executor
+	// we resolve the command of each step into the argv
+	// that is passed to the container executor
 	for i, step := range p.Steps {
-		p.Steps[i].commands = strings.Fields(step.Command)
+		commands, err := step.buildCommand()
+		if err != nil {
+			return fmt.Errorf("step %s: %w", stepName(step, i), err)
+		}
+		p.Steps[i].commands = commands
 	}
 
 	return p.Validate()
 }
 
+// stepName returns the name of the step for error messages, falling back to its position.
+func stepName(step Step, i int) string {
+	if step.Name != "" {
+		return step.Name
+	}
+	return fmt.Sprintf("%d", i)
+}
+
 func (p *Pipeline) AddStep(step Step) {
 	p.Steps = append(p.Steps, step)
 }
@@ -123,15 +448,81 @@ func (p *Pipeline) Validate() error {
 	if len(p.Steps) == 0 {
 		return fmt.Errorf("pipeline must contain at least one step")
 	}
+	seenRepos := make(map[string]bool, len(p.Repos))
+	for i, repo := range p.Repos {
+		if repo.Name == "" {
+			return fmt.Errorf("repo %d must have a name", i)
+		}
+		if seenRepos[repo.Name] {
+			return fmt.Errorf("repo %s is listed more than once", repo.Name)
+		}
+		seenRepos[repo.Name] = true
+	}
+	if p.Targets != nil {
+		if err := p.Targets.Validate(); err != nil {
+			return fmt.Errorf("targets: %w", err)
+		}
+	}
+	if err := p.validatePublicationTemplates(); err != nil {
+		return err
+	}
+	for i, condition := range p.When {
+		if err := condition.validate(); err != nil {
+			return fmt.Errorf("when condition %d: %w", i, err)
+		}
+	}
+	seenSteps := make(map[string]bool, len(p.Steps))
 	for i, step := range p.Steps {
 		if step.Name == "" {
 			return fmt.Errorf("step %d must have a name", i)
 		}
-		if step.Image == "" {
+		if seenSteps[step.Name] {
+			return fmt.Errorf("step name %s is used more than once", step.Name)
+		}
+		seenSteps[step.Name] = true
+		et, err := p.StepExecutor(step)
+		if err != nil {
+			return fmt.Errorf("step %s: %w", step.Name, err)
+		}
+		local := et == LocalExecutor
+		if step.Image == "" && !local {
 			return fmt.Errorf("step %s must specify a Docker image", step.Name)
 		}
+		if len(step.Volumes) > 0 && local {
+			return fmt.Errorf("step %s: volumes can't be used with the local executor", step.Name)
+		}
+		if step.User != "" && local {
+			return fmt.Errorf("step %s: user can't be used with the local executor", step.Name)
+		}
 		if len(step.commands) == 0 {
-			return fmt.Errorf("step %s must specify at least one command", step.Name)
+			commands, err := step.buildCommand()
+			if err != nil {
+				return fmt.Errorf("step %s: %w", step.Name, err)
+			}
+			p.Steps[i].commands = commands
+		}
+		if _, err := parseDuration(step.Timeout); err != nil {
+			return fmt.Errorf("step %s has an invalid timeout: %w", step.Name, err)
+		}
+		if err := step.Retry.validate(); err != nil {
+			return fmt.Errorf("step %s: %w", step.Name, err)
+		}
+		if _, err := step.ParsedVolumes(); err != nil {
+			return fmt.Errorf("step %s: %w", step.Name, err)
+		}
+		if err := step.validateTemplates(); err != nil {
+			return fmt.Errorf("step %s: %w", step.Name, err)
+		}
+		if step.If != "" {
+			previous := make([]string, 0, i)
+			for _, prev := range p.Steps[:i] {
+				previous = append(previous, prev.Name)
+			}
+			condition, err := ParseExpression(step.If, previous)
+			if err != nil {
+				return fmt.Errorf("step %s has an invalid if expression: %w", step.Name, err)
+			}
+			p.Steps[i].condition = condition
 		}
 	}
 	return nil
@@ -0,0 +1,157 @@
+package pipeline
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/brightfame/metamorph/internal/config"
+)
+
+func TestValidateStepTimeoutAndRetry(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name          string
+		step          string
+		expectedError string
+	}{
+		{"No timeout or retry", "", ""},
+		{"Valid timeout", "timeout: 5m", ""},
+		{"Valid retry", "retry: {max_attempts: 3, interval: 10s, backoff: exponential}", ""},
+		{"Invalid timeout", "timeout: five minutes", "step test has an invalid timeout"},
+		{"Negative timeout", "timeout: -1s", "must not be negative"},
+		{"Invalid interval", "retry: {max_attempts: 3, interval: 10}", "invalid retry interval"},
+		{"Negative attempts", "retry: {max_attempts: -1}", "max_attempts must not be negative"},
+		{"Unknown backoff", "retry: {max_attempts: 2, backoff: linear}", `unknown retry backoff "linear"`},
+	}
+
+	for _, testCase := range testCases {
+		// The following is necessary to make sure testCase's values don't
+		// get updated due to concurrency within the scope of t.Run(..) below
+		testCase := testCase
+
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			manifest := "steps:\n  - name: test\n    image: alpine\n    command: ls\n"
+			if testCase.step != "" {
+				manifest += "    " + testCase.step + "\n"
+			}
+
+			err := parseFile(&Pipeline{}, manifest)
+			if testCase.expectedError == "" {
+				require.NoError(t, err)
+			} else {
+				require.ErrorContains(t, err, testCase.expectedError)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	t.Parallel()
+
+	constant := RetryPolicy{MaxAttempts: 3, Interval: "2s"}
+	require.Equal(t, 3, constant.Attempts())
+	require.Equal(t, 2*time.Second, constant.Delay(1))
+	require.Equal(t, 2*time.Second, constant.Delay(2))
+
+	exponential := RetryPolicy{MaxAttempts: 4, Interval: "2s", Backoff: ExponentialBackoff}
+	require.Equal(t, 2*time.Second, exponential.Delay(1))
+	require.Equal(t, 4*time.Second, exponential.Delay(2))
+	require.Equal(t, 8*time.Second, exponential.Delay(3))
+
+	require.Equal(t, 1, RetryPolicy{}.Attempts())
+}
+
+func TestValidateRepos(t *testing.T) {
+	t.Parallel()
+
+	steps := "steps:\n  - name: test\n    image: alpine\n    command: ls\n"
+
+	p := &Pipeline{}
+	require.NoError(t, parseFile(p, "repos:\n  - backend/es-indexer\n  - name: backend/critical-updates\n    base_branch: develop\n"+steps))
+	require.Len(t, p.Repos, 2)
+	require.Equal(t, "develop", p.Repos[1].BaseBranch)
+
+	err := parseFile(&Pipeline{}, "repos:\n  - backend/es-indexer\n  - name: backend/es-indexer\n"+steps)
+	require.ErrorContains(t, err, "repo backend/es-indexer is listed more than once")
+
+	err = parseFile(&Pipeline{}, "repos:\n  - base_branch: develop\n"+steps)
+	require.ErrorContains(t, err, "repo 0 must have a name")
+}
+
+func TestValidateTargets(t *testing.T) {
+	t.Parallel()
+
+	steps := "steps:\n  - name: test\n    image: alpine\n    command: ls\n"
+
+	p := &Pipeline{}
+	require.NoError(t, parseFile(p, "targets:\n  group: backend\n  include_subgroups: true\n  topics: [node]\n  name: \"*-service\"\n"+steps))
+	require.Equal(t, "backend", p.Targets.Group)
+	require.True(t, p.Targets.IncludeSubgroups)
+
+	err := parseFile(&Pipeline{}, "targets:\n  visibility: secret\n"+steps)
+	require.ErrorContains(t, err, `targets: unknown visibility "secret"`)
+
+	err = parseFile(&Pipeline{}, "targets:\n  name: \"[\"\n"+steps)
+	require.ErrorContains(t, err, "invalid name glob")
+}
+
+func TestExpandEnvVars(t *testing.T) {
+	t.Setenv("METAMORPH_TEST_TOKEN", "from-env")
+	t.Setenv("NPM_AUTH", "secret")
+
+	expanded := expandEnvVars([]byte(`org: ${GITLAB_ORG}, auth: $NPM_AUTH, output: "$METAMORPH_OUTPUT", token: ${METAMORPH_TEST_TOKEN}`), map[string]string{"GITLAB_ORG": "backend"})
+	require.Equal(t, `org: backend, auth: secret, output: "${METAMORPH_OUTPUT}", token: ${METAMORPH_TEST_TOKEN}`, expanded)
+
+	// template variables are left for the template engine
+	expanded = expandEnvVars([]byte(`run: echo {{ range $k, $v := .Vars }}{{ $k }}={{ $v }} {{ end }}$NPM_AUTH`), nil)
+	require.Equal(t, `run: echo {{ range $k, $v := .Vars }}{{ $k }}={{ $v }} {{ end }}secret`, expanded)
+}
+
+func TestValidateStepExecutor(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name          string
+		runExecutor   string
+		step          string
+		expectedError string
+	}{
+		{"Default executor", "", "image: alpine", ""},
+		{"Container executor", "", "executor: container\n    image: alpine", ""},
+		{"Local executor without image", "", "executor: local", ""},
+		{"Container executor without image", "", "executor: container", "step test must specify a Docker image"},
+		{"Unknown executor", "", "executor: ssh", `step test: unknown executor type "ssh"`},
+		{"Local executor with volumes", "", "executor: local\n    volumes: [./scripts:/scripts]", "volumes can't be used with the local executor"},
+		{"Container executor as root", "", "image: alpine\n    user: root", ""},
+		{"Local executor with user", "", "executor: local\n    user: root", "user can't be used with the local executor"},
+		{"Local run without image", "local", "", ""},
+		{"Local run with volumes", "local", "volumes: [./scripts:/scripts]", "volumes can't be used with the local executor"},
+		{"Local run with user", "local", "user: root", "user can't be used with the local executor"},
+		{"Container step in a local run", "local", "executor: container", "step test must specify a Docker image"},
+		{"Local step in a container run", "container", "executor: local", ""},
+		{"Unknown run executor", "ssh", "image: alpine", `step test: unknown executor type "ssh"`},
+	}
+
+	for _, testCase := range testCases {
+		// The following is necessary to make sure testCase's values don't
+		// get updated due to concurrency within the scope of t.Run(..) below
+		testCase := testCase
+
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			manifest := "steps:\n  - name: test\n    command: sed -i s/16/22/ .nvmrc\n    " + testCase.step + "\n"
+			err := parseFile(&Pipeline{cfg: &config.Config{Executor: testCase.runExecutor}}, manifest)
+			if testCase.expectedError == "" {
+				require.NoError(t, err)
+			} else {
+				require.ErrorContains(t, err, testCase.expectedError)
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package pipeline
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// Render returns a copy of the step with the Go templates in its command, run script, args and environment values
+// expanded against the context, e.g. "{{ .Steps.detect.Outputs.node_version }}" or, for step names that aren't
+// identifiers, "{{ (index .Steps \"run tests\").Outputs.report }}". Missing values expand to an empty string unless
+// strict is set, in which case they are an error.
+func (s Step) Render(ctx *ExpressionContext, strict bool) (Step, error) {
+	var err error
+	if s.Command, err = renderTemplate("command", s.Command, ctx, strict); err != nil {
+		return s, err
+	}
+	if s.Run, err = renderTemplate("run", s.Run, ctx, strict); err != nil {
+		return s, err
+	}
+
+	if len(s.Args) > 0 {
+		args := make([]string, len(s.Args))
+		for i, arg := range s.Args {
+			if args[i], err = renderTemplate(fmt.Sprintf("args[%d]", i), arg, ctx, strict); err != nil {
+				return s, err
+			}
+		}
+		s.Args = args
+	}
+
+	if len(s.Env) > 0 {
+		env := make(map[string]string, len(s.Env))
+		for k, v := range s.Env {
+			if env[k], err = renderTemplate("environment."+k, v, ctx, strict); err != nil {
+				return s, err
+			}
+		}
+		s.Env = env
+	}
+
+	if s.commands, err = s.buildCommand(); err != nil {
+		return s, err
+	}
+	return s, nil
+}
+
+// validateTemplates checks the templates of the step parse.
+func (s *Step) validateTemplates() error {
+	fields := map[string]string{"command": s.Command, "run": s.Run}
+	for i, arg := range s.Args {
+		fields[fmt.Sprintf("args[%d]", i)] = arg
+	}
+	for k, v := range s.Env {
+		fields["environment."+k] = v
+	}
+
+	return validateTemplates(fields)
+}
+
+// Publication is the branch, commit and change request of a repo, rendered from the templates of the manifest.
+type Publication struct {
+	Branch        string
+	CommitMessage string
+	Title         string
+	Description   string
+	Labels        []string
+}
+
+// RenderPublication renders the branch name, commit message and change request title, description and labels for
+// the repo described by the context.
+func (p *Pipeline) RenderPublication(ctx *ExpressionContext) (Publication, error) {
+	spec := p.ChangeRequest()
+	pub := Publication{
+		Branch:        p.BranchName(),
+		CommitMessage: p.CommitMessage(),
+		Title:         spec.Title,
+		Description:   spec.Description,
+	}
+
+	fields := map[string]*string{
+		"branch_name":    &pub.Branch,
+		"commit message": &pub.CommitMessage,
+		"title":          &pub.Title,
+		"description":    &pub.Description,
+	}
+	for name, value := range fields {
+		rendered, err := renderTemplate(name, *value, ctx, p.Strict)
+		if err != nil {
+			return pub, err
+		}
+		*value = rendered
+	}
+	if pub.Title == "" {
+		pub.Title = pub.CommitMessage
+	}
+
+	for i, label := range spec.Labels {
+		rendered, err := renderTemplate(fmt.Sprintf("labels[%d]", i), label, ctx, p.Strict)
+		if err != nil {
+			return pub, err
+		}
+		if rendered != "" {
+			pub.Labels = append(pub.Labels, rendered)
+		}
+	}
+
+	return pub, nil
+}
+
+// validatePublicationTemplates checks the templates of the branch, commit and change request parse.
+func (p *Pipeline) validatePublicationTemplates() error {
+	spec := p.ChangeRequest()
+	fields := map[string]string{
+		"branch_name":    spec.BranchName,
+		"commit message": p.Commit.Message,
+		"title":          spec.Title,
+		"description":    spec.Description,
+	}
+	for i, label := range spec.Labels {
+		fields[fmt.Sprintf("labels[%d]", i)] = label
+	}
+	return validateTemplates(fields)
+}
+
+// validateTemplates checks every template in fields, keyed by field name, parses.
+func validateTemplates(fields map[string]string) error {
+	for name, text := range fields {
+		if _, err := parseTemplate(name, text, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renderTemplate expands text as a Go template. Text without actions is returned as is.
+func renderTemplate(name, text string, data any, strict bool) (string, error) {
+	tmpl, err := parseTemplate(name, text, strict)
+	if err != nil || tmpl == nil {
+		return text, err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("unable to render %s: %w", name, err)
+	}
+	return buf.String(), nil
+}
+
+// parseTemplate parses text as a Go template. It returns nil if the text has no actions. Strict templates fail on
+// missing map keys, e.g. an undefined variable, instead of rendering the zero value.
+func parseTemplate(name, text string, strict bool) (*template.Template, error) {
+	if !strings.Contains(text, "{{") {
+		return nil, nil
+	}
+
+	missingKey := "missingkey=zero"
+	if strict {
+		missingKey = "missingkey=error"
+	}
+	tmpl, err := template.New(name).Option(missingKey).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template in %s: %w", name, err)
+	}
+	return tmpl, nil
+}
@@ -0,0 +1,110 @@
+package pipeline
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStepRender(t *testing.T) {
+	t.Parallel()
+
+	manifest := `steps:
+  - name: detect
+    image: node:22
+    run: echo "node_version=$(node --version)" >> "$METAMORPH_OUTPUT"
+  - name: upgrade
+    image: node:22
+    command: /scripts/upgrade-yarn-pkg "@types/node" "^{{ .Steps.detect.Outputs.node_version }}"
+    environment:
+      REPO: "{{ .Repo.Name }}"
+      MISSING: "{{ .Steps.detect.Outputs.missing }}"
+`
+	p := &Pipeline{}
+	require.NoError(t, parseFile(p, manifest))
+
+	ctx := &ExpressionContext{
+		Repo: RepoContext{Name: "backend/es-indexer"},
+		Steps: map[string]StepContext{
+			"detect": {Outcome: "succeeded", Outputs: map[string]string{"node_version": "22.10.5"}},
+		},
+	}
+	step, err := p.Steps[1].Render(ctx, false)
+	require.NoError(t, err)
+	require.Equal(t, []string{"/bin/sh", "-e", "-c", `/scripts/upgrade-yarn-pkg "@types/node" "^22.10.5"`}, step.Commands())
+	require.Equal(t, map[string]string{"REPO": "backend/es-indexer", "MISSING": ""}, step.Env)
+
+	// the original step is left untouched
+	require.Contains(t, p.Steps[1].Command, "{{ .Steps.detect.Outputs.node_version }}")
+
+	err = parseFile(&Pipeline{}, "steps:\n  - name: test\n    image: alpine\n    command: echo {{ .Steps.detect\n")
+	require.ErrorContains(t, err, "step test: invalid template in command")
+}
+
+func TestStepRenderStrict(t *testing.T) {
+	t.Parallel()
+
+	step := Step{Name: "test", Image: "alpine", Command: "echo {{ .Vars.NODE_VERSION }}"}
+	ctx := &ExpressionContext{Vars: map[string]string{}}
+
+	rendered, err := step.Render(ctx, false)
+	require.NoError(t, err)
+	require.Equal(t, []string{"/bin/sh", "-e", "-c", "echo "}, rendered.Commands())
+
+	_, err = step.Render(ctx, true)
+	require.ErrorContains(t, err, `map has no entry for key "NODE_VERSION"`)
+
+	ctx.Vars["NODE_VERSION"] = "22"
+	rendered, err = step.Render(ctx, true)
+	require.NoError(t, err)
+	require.Equal(t, []string{"/bin/sh", "-e", "-c", "echo 22"}, rendered.Commands())
+}
+
+func TestRenderPublication(t *testing.T) {
+	t.Parallel()
+
+	manifest := `name: node v22 upgrade
+strict: true
+vars:
+  NODE_VERSION: "22"
+gitlab:
+  branch_name: "node-v{{ .Vars.NODE_VERSION }}"
+  merge_request_title: "Upgrade {{ .Repo.Name }} to node {{ .Vars.NODE_VERSION }}"
+  merge_request_description: "Previously on {{ .Steps.detect.Outputs.node_version }}, targets {{ .Repo.DefaultBranch }}."
+  labels:
+    - automated-pr
+    - "node-{{ .Vars.NODE_VERSION }}"
+steps:
+  - name: detect
+    image: node:22
+    command: node --version
+`
+	p := &Pipeline{}
+	require.NoError(t, parseFile(p, manifest))
+	require.Equal(t, map[string]string{"NODE_VERSION": "22"}, p.Vars)
+
+	ctx := &ExpressionContext{
+		Repo: RepoContext{Name: "backend/es-indexer", Path: "myorg/backend/es-indexer", BaseBranch: "main"},
+		Vars: p.Vars,
+		Steps: map[string]StepContext{
+			"detect": {Outputs: map[string]string{"node_version": "18.20.4"}},
+		},
+	}
+	pub, err := p.RenderPublication(ctx)
+	require.NoError(t, err)
+	require.Equal(t, Publication{
+		Branch:        "node-v22",
+		CommitMessage: "Upgrade backend/es-indexer to node 22",
+		Title:         "Upgrade backend/es-indexer to node 22",
+		Description:   "Previously on 18.20.4, targets main.",
+		Labels:        []string{"automated-pr", "node-22"},
+	}, pub)
+
+	// strict mode rejects undefined variables
+	ctx.Vars = map[string]string{}
+	_, err = p.RenderPublication(ctx)
+	require.ErrorContains(t, err, `map has no entry for key "NODE_VERSION"`)
+
+	err = parseFile(&Pipeline{}, "gitlab:\n  branch_name: \"{{ .Vars.X \"\nsteps:\n  - name: test\n    image: alpine\n    command: ls\n")
+	require.ErrorContains(t, err, "invalid template in branch_name")
+}
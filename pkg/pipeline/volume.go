@@ -0,0 +1,144 @@
+package pipeline
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// VolumeType is the kind of volume mounted into a step container.
+type VolumeType string
+
+const (
+	// VolumeBind mounts a file or directory of the host. Relative sources are resolved against the directory of the
+	// manifest that declares the volume.
+	VolumeBind VolumeType = "bind"
+	// VolumeNamed mounts a named volume managed by the container runtime, e.g. a shared cache.
+	VolumeNamed VolumeType = "volume"
+	// VolumeTmpfs mounts an empty in-memory filesystem that is discarded with the container.
+	VolumeTmpfs VolumeType = "tmpfs"
+)
+
+// tmpfsSource is the source that selects a tmpfs mount, e.g. "tmpfs:/tmp/cache".
+const tmpfsSource = "tmpfs"
+
+// volumeNamePattern matches the names the container runtimes accept for named volumes.
+var volumeNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// Volume is a parsed volume of a step. Volumes are written as SOURCE:TARGET[:MODE], where SOURCE is a host path
+// (absolute or starting with ./ or ../), the name of a named volume or "tmpfs", and MODE is ro or rw (default).
+type Volume struct {
+	Type     VolumeType
+	Source   string
+	Target   string
+	ReadOnly bool
+}
+
+// ParseVolume parses a volume spec such as "./scripts:/scripts:ro", "go-cache:/root/.cache/go-build" or
+// "tmpfs:/tmp".
+func ParseVolume(spec string) (Volume, error) {
+	parts := strings.Split(spec, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return Volume{}, fmt.Errorf("volume %q must have the form SOURCE:TARGET[:ro|rw]", spec)
+	}
+
+	v := Volume{Source: parts[0], Target: parts[1]}
+	if len(parts) == 3 {
+		switch parts[2] {
+		case "ro":
+			v.ReadOnly = true
+		case "rw":
+		default:
+			return Volume{}, fmt.Errorf("volume %q has an unknown mode %q, must be ro or rw", spec, parts[2])
+		}
+	}
+
+	if v.Target == "" || !path.IsAbs(v.Target) {
+		return Volume{}, fmt.Errorf("volume %q must have an absolute target path inside the container", spec)
+	}
+
+	switch {
+	case v.Source == "":
+		return Volume{}, fmt.Errorf("volume %q must have a source", spec)
+	case v.Source == tmpfsSource:
+		v.Type = VolumeTmpfs
+		v.Source = ""
+	case isHostPath(v.Source):
+		v.Type = VolumeBind
+	case volumeNamePattern.MatchString(v.Source):
+		v.Type = VolumeNamed
+	default:
+		return Volume{}, fmt.Errorf("volume %q has an invalid source, use an absolute path, a path starting with ./ or ../, a volume name or tmpfs", spec)
+	}
+
+	return v, nil
+}
+
+// String formats the volume as a spec that ParseVolume accepts.
+func (v Volume) String() string {
+	source := v.Source
+	if v.Type == VolumeTmpfs {
+		source = tmpfsSource
+	}
+	spec := source + ":" + v.Target
+	if v.ReadOnly {
+		spec += ":ro"
+	}
+	return spec
+}
+
+// isHostPath returns true if the volume source refers to a path on the host rather than a named volume.
+func isHostPath(source string) bool {
+	return filepath.IsAbs(source) || source == "." || source == ".." ||
+		strings.HasPrefix(source, "./") || strings.HasPrefix(source, "../")
+}
+
+// ParsedVolumes returns the parsed volumes of the step.
+func (s *Step) ParsedVolumes() ([]Volume, error) {
+	volumes := make([]Volume, 0, len(s.Volumes))
+	for _, spec := range s.Volumes {
+		v, err := ParseVolume(spec)
+		if err != nil {
+			return nil, err
+		}
+		volumes = append(volumes, v)
+	}
+	return volumes, nil
+}
+
+// resolveVolumes makes the relative host paths of the volumes of the steps and step templates absolute, relative
+// to dir, the directory of the manifest that declares them.
+func (p *Pipeline) resolveVolumes(dir string) error {
+	resolve := func(step *Step, name string) error {
+		for i, spec := range step.Volumes {
+			v, err := ParseVolume(spec)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			if v.Type != VolumeBind || filepath.IsAbs(v.Source) {
+				continue
+			}
+			if dir == "" {
+				return fmt.Errorf("%s: volume %q has a relative source, which isn't supported in manifests included from git", name, spec)
+			}
+			v.Source = filepath.Join(dir, v.Source)
+			step.Volumes[i] = v.String()
+		}
+		return nil
+	}
+
+	for i := range p.Steps {
+		if err := resolve(&p.Steps[i], "step "+stepName(p.Steps[i], i)); err != nil {
+			return err
+		}
+	}
+	for name, tmpl := range p.Templates {
+		if err := resolve(&tmpl.Step, "step template "+name); err != nil {
+			return err
+		}
+		p.Templates[name] = tmpl
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package pipeline
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/brightfame/metamorph/internal/config"
+)
+
+func TestParseVolume(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		spec     string
+		expected Volume
+		err      string
+	}{
+		{"./scripts:/scripts", Volume{Type: VolumeBind, Source: "./scripts", Target: "/scripts"}, ""},
+		{"/etc/ssl/certs:/etc/ssl/certs:ro", Volume{Type: VolumeBind, Source: "/etc/ssl/certs", Target: "/etc/ssl/certs", ReadOnly: true}, ""},
+		{"../shared:/shared:rw", Volume{Type: VolumeBind, Source: "../shared", Target: "/shared"}, ""},
+		{"go-cache:/root/.cache/go-build", Volume{Type: VolumeNamed, Source: "go-cache", Target: "/root/.cache/go-build"}, ""},
+		{"tmpfs:/tmp", Volume{Type: VolumeTmpfs, Target: "/tmp"}, ""},
+		{"/scripts", Volume{}, "must have the form SOURCE:TARGET[:ro|rw]"},
+		{"./a:/b:ro:z", Volume{}, "must have the form SOURCE:TARGET[:ro|rw]"},
+		{"./scripts:/scripts:rx", Volume{}, `unknown mode "rx"`},
+		{"./scripts:scripts", Volume{}, "must have an absolute target path"},
+		{":/scripts", Volume{}, "must have a source"},
+		{"scripts dir:/scripts", Volume{}, "has an invalid source"},
+	}
+
+	for _, testCase := range testCases {
+		// The following is necessary to make sure testCase's values don't
+		// get updated due to concurrency within the scope of t.Run(..) below
+		testCase := testCase
+
+		t.Run(testCase.spec, func(t *testing.T) {
+			t.Parallel()
+
+			v, err := ParseVolume(testCase.spec)
+			if testCase.err != "" {
+				require.ErrorContains(t, err, testCase.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, testCase.expected, v)
+
+			// formatting the volume round trips, apart from the default rw mode
+			again, err := ParseVolume(v.String())
+			require.NoError(t, err)
+			require.Equal(t, v, again)
+		})
+	}
+}
+
+func TestLoadManifestFileResolvesVolumes(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	writeManifest(t, dir, "lib/steps.yaml", `templates:
+  lint:
+    step:
+      image: golangci/golangci-lint
+      command: golangci-lint run
+      volumes:
+        - ./lint.yaml:/etc/lint.yaml:ro
+`)
+	writeManifest(t, dir, "manifests/upgrade.yaml", `include:
+  - ../lib/steps.yaml
+steps:
+  - name: upgrade
+    image: alpine
+    command: /scripts/upgrade
+    volumes:
+      - ./scripts:/scripts:ro
+      - go-cache:/root/.cache
+      - tmpfs:/tmp
+  - uses: lint
+`)
+
+	p, err := LoadManifestFile(&config.Config{}, filepath.Join(dir, "manifests", "upgrade.yaml"))
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		filepath.Join(dir, "manifests", "scripts") + ":/scripts:ro",
+		"go-cache:/root/.cache",
+		"tmpfs:/tmp",
+	}, p.Steps[0].Volumes)
+	require.Equal(t, []string{filepath.Join(dir, "lib", "lint.yaml") + ":/etc/lint.yaml:ro"}, p.Steps[1].Volumes)
+
+	writeManifest(t, dir, "invalid.yaml", "steps:\n  - name: test\n    image: alpine\n    command: ls\n    volumes:\n      - /scripts\n")
+	_, err = LoadManifestFile(&config.Config{}, filepath.Join(dir, "invalid.yaml"))
+	require.ErrorContains(t, err, `step test: volume "/scripts" must have the form SOURCE:TARGET[:ro|rw]`)
+}
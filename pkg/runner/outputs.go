@@ -0,0 +1,127 @@
+package runner
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+const (
+	// OutputEnvVar is the environment variable with the path of the file a step writes its outputs to.
+	OutputEnvVar = "METAMORPH_OUTPUT"
+	// OutputMountPath is where the directory with the output files is mounted inside the container.
+	OutputMountPath = "/metamorph"
+)
+
+var outputKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+// newOutputFile creates an empty output file for the step in the output directory of the workspace. The file is
+// world-writable since the container may run as a different user.
+func newOutputFile(ws *workspace) (string, error) {
+	f, err := os.CreateTemp(ws.OutputDir, "output-")
+	if err != nil {
+		return "", fmt.Errorf("unable to create output file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Chmod(f.Name(), 0o666); err != nil {
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// readOutputs reads and parses the output file of a step.
+func readOutputs(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read step outputs: %w", err)
+	}
+	return parseOutputs(data)
+}
+
+// parseOutputs parses key=value lines. Multi-line values use a heredoc-style delimiter:
+//
+//	changelog<<EOF
+//	line one
+//	line two
+//	EOF
+//
+// Later values replace earlier values with the same key.
+func parseOutputs(data []byte) (map[string]string, error) {
+	outputs := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		if key, delimiter, ok := strings.Cut(line, "<<"); ok && !strings.Contains(key, "=") {
+			if !outputKeyPattern.MatchString(key) {
+				return nil, fmt.Errorf("invalid output name %q on line %d", key, lineNumber)
+			}
+			var value []string
+			terminated := false
+			for scanner.Scan() {
+				lineNumber++
+				valueLine := strings.TrimRight(scanner.Text(), "\r")
+				if valueLine == delimiter {
+					terminated = true
+					break
+				}
+				value = append(value, valueLine)
+			}
+			if !terminated {
+				return nil, fmt.Errorf("output %s is missing the closing delimiter %s", key, delimiter)
+			}
+			outputs[key] = strings.Join(value, "\n")
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || !outputKeyPattern.MatchString(key) {
+			return nil, fmt.Errorf("invalid output on line %d, expected name=value", lineNumber)
+		}
+		outputs[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to parse step outputs: %w", err)
+	}
+
+	return outputs, nil
+}
+
+// outputEnv returns the outputs of the previous steps as environment variables named
+// METAMORPH_STEPS_<STEP>_<KEY>, e.g. METAMORPH_STEPS_DETECT_NODE_VERSION.
+func outputEnv(steps []Result) map[string]string {
+	env := make(map[string]string)
+	for _, step := range steps {
+		for key, value := range step.Outputs {
+			env[fmt.Sprintf("METAMORPH_STEPS_%s_%s", envName(step.StepName), envName(key))] = value
+		}
+	}
+	return env
+}
+
+// envName converts s into an upper case environment variable name.
+func envName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r > unicode.MaxASCII || !(unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return '_'
+		}
+		return unicode.ToUpper(r)
+	}, s)
+}
+
+// outputContainerPath returns the path of the output file inside the container.
+func outputContainerPath(hostPath string) string {
+	return OutputMountPath + "/" + filepath.Base(hostPath)
+}
@@ -0,0 +1,39 @@
+package runner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseOutputs(t *testing.T) {
+	t.Parallel()
+
+	data := "node_version=22.10.5\n\nurl=https://example.com/?a=b\nchangelog<<EOF\nline one\nline two\nEOF\nnode_version=22.11.0\n"
+	outputs, err := parseOutputs([]byte(data))
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		"node_version": "22.11.0",
+		"url":          "https://example.com/?a=b",
+		"changelog":    "line one\nline two",
+	}, outputs)
+
+	_, err = parseOutputs([]byte("not an output\n"))
+	require.ErrorContains(t, err, "invalid output on line 1, expected name=value")
+
+	_, err = parseOutputs([]byte("1st=value\n"))
+	require.ErrorContains(t, err, "invalid output on line 1")
+
+	_, err = parseOutputs([]byte("changelog<<EOF\nline one\n"))
+	require.ErrorContains(t, err, "output changelog is missing the closing delimiter EOF")
+}
+
+func TestOutputEnv(t *testing.T) {
+	t.Parallel()
+
+	env := outputEnv([]Result{
+		{StepName: "detect node", Outputs: map[string]string{"node_version": "22"}},
+		{StepName: "upgrade-yarn-pkg-@types/node"},
+	})
+	require.Equal(t, map[string]string{"METAMORPH_STEPS_DETECT_NODE_NODE_VERSION": "22"}, env)
+}
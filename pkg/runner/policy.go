@@ -0,0 +1,30 @@
+package runner
+
+import "fmt"
+
+// FailurePolicy determines how a failure in one repository affects the rest of the run.
+type FailurePolicy string
+
+const (
+	// FailFast stops the run at the first failing repository. Repositories that haven't started are skipped.
+	FailFast FailurePolicy = "fail-fast"
+	// ContinueOnFailure keeps processing the remaining repositories when one fails.
+	ContinueOnFailure FailurePolicy = "continue"
+)
+
+// String returns the failure policy string.
+func (fp FailurePolicy) String() string {
+	return string(fp)
+}
+
+// ParseFailurePolicy parses the given string into a FailurePolicy. An empty string defaults to ContinueOnFailure.
+func ParseFailurePolicy(fp string) (FailurePolicy, error) {
+	switch fp {
+	case "", ContinueOnFailure.String():
+		return ContinueOnFailure, nil
+	case FailFast.String():
+		return FailFast, nil
+	default:
+		return "", fmt.Errorf("unknown failure policy: %s", fp)
+	}
+}
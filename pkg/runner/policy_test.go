@@ -0,0 +1,22 @@
+package runner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFailurePolicy(t *testing.T) {
+	t.Parallel()
+
+	policy, err := ParseFailurePolicy("")
+	require.NoError(t, err)
+	require.Equal(t, ContinueOnFailure, policy)
+
+	policy, err = ParseFailurePolicy("fail-fast")
+	require.NoError(t, err)
+	require.Equal(t, FailFast, policy)
+
+	_, err = ParseFailurePolicy("abort")
+	require.ErrorContains(t, err, "unknown failure policy: abort")
+}
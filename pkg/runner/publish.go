@@ -0,0 +1,156 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/brightfame/metamorph/pkg/git"
+	"github.com/brightfame/metamorph/pkg/pipeline"
+	"github.com/brightfame/metamorph/pkg/scm"
+)
+
+// publish commits any changes in the workspace to the pipeline branch and pushes it to the remote. Workspaces without
+// changes are marked as a no-op.
+func (r *Runner) publish(ctx context.Context, ws *workspace, pub pipeline.Publication, result *RepoResult, logger *zap.SugaredLogger) error {
+	dirty, err := git.HasChanges(ws.Path)
+	if err != nil {
+		return err
+	}
+	if !dirty {
+		logger.Infof("No changes detected in %s, skipping commit", ws.Repo)
+		result.Status = RepoStatusNoOp
+		return nil
+	}
+
+	auth, err := r.platform.Auth()
+	if err != nil {
+		return err
+	}
+
+	// the branch is replaced on every run, which must not destroy commits that someone else pushed to it
+	branch := pub.Branch
+	authorName, authorEmail := r.p.CommitAuthor()
+	authors, err := git.RemoteBranchAuthors(ctx, ws.Path, git.FetchOptions{
+		Branch:   branch,
+		Auth:     auth,
+		CABundle: r.platform.CABundle(),
+	})
+	if err != nil {
+		return err
+	}
+	for _, author := range authors {
+		if author != authorEmail {
+			return fmt.Errorf("branch %s of %s has commits by %s, refusing to overwrite a branch not created by metamorph", branch, ws.Repo, author)
+		}
+	}
+
+	if err := git.CheckoutNewBranch(ws.Path, branch); err != nil {
+		return err
+	}
+
+	sha, err := git.CommitAll(ws.Path, git.CommitOptions{
+		Message:     pub.CommitMessage,
+		AuthorName:  authorName,
+		AuthorEmail: authorEmail,
+	})
+	if err != nil {
+		return err
+	}
+	logger.Infof("Committed changes to branch %s (%s)", branch, sha)
+
+	// the branch only has commits of metamorph, so re-running a pipeline replaces the previous changes
+	err = git.Push(ctx, ws.Path, git.PushOptions{
+		Branch:   branch,
+		Auth:     auth,
+		CABundle: r.platform.CABundle(),
+		Force:    true,
+	})
+	if err != nil {
+		return err
+	}
+	logger.Infof("Pushed branch %s", branch)
+
+	result.Branch = branch
+	result.CommitSHA = sha
+
+	cr, err := r.openChangeRequest(ctx, ws, pub)
+	if err != nil {
+		return err
+	}
+	logger.Infof("Change request ready at %s", cr.URL)
+	result.ChangeRequestURL = cr.URL
+
+	result.Status = RepoStatusSucceeded
+
+	return nil
+}
+
+// openChangeRequest creates or updates the merge request (GitLab) or pull request (GitHub) for the branch.
+func (r *Runner) openChangeRequest(ctx context.Context, ws *workspace, pub pipeline.Publication) (*scm.ChangeRequest, error) {
+	cr, err := r.platform.CreateOrUpdateChangeRequest(ctx, scm.ChangeRequestOptions{
+		Repo:         ws.Repo,
+		SourceBranch: pub.Branch,
+		TargetBranch: ws.BaseBranch,
+		Title:        pub.Title,
+		Description:  pub.Description,
+		Labels:       pub.Labels,
+		Assignees:    r.p.Assignees,
+		Reviewers:    r.p.Reviewers,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to open change request for %s: %w", ws.Repo, err)
+	}
+
+	return cr, nil
+}
+
+// preview records the diff of the workspace for a dry run instead of publishing it with pub. When a patch directory
+// is configured, the diff is also written to <patch dir>/<repo>.patch.
+func (r *Runner) preview(ws *workspace, pub pipeline.Publication, result *RepoResult, logger *zap.SugaredLogger) error {
+	dirty, err := git.HasChanges(ws.Path)
+	if err != nil {
+		return err
+	}
+	if !dirty {
+		logger.Infof("No changes detected in %s", ws.Repo)
+		result.Status = RepoStatusNoOp
+		return nil
+	}
+
+	diff, err := git.WorktreeDiff(ws.Path)
+	if err != nil {
+		return err
+	}
+	logger.Infof("Dry run changed %d files in %s", diff.FilesChanged, ws.Repo)
+	logger.Infof("A real run would push branch %s and open %q", pub.Branch, pub.Title)
+
+	result.Status = RepoStatusChanged
+	result.Diff = diff.Patch
+	result.DiffStat = diff.Stat()
+
+	if r.cfg.PatchDir == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(r.cfg.PatchDir, 0o755); err != nil {
+		return fmt.Errorf("unable to create patch directory: %w", err)
+	}
+	patchFile := filepath.Join(r.cfg.PatchDir, patchFileName(ws.Repo))
+	if err := os.WriteFile(patchFile, []byte(diff.Patch), 0o644); err != nil {
+		return fmt.Errorf("unable to write patch for %s: %w", ws.Repo, err)
+	}
+	logger.Infof("Wrote patch to %s", patchFile)
+	result.PatchFile = patchFile
+
+	return nil
+}
+
+// patchFileName returns the name of the patch file of the repo, e.g. "backend_es-indexer.patch".
+func patchFileName(repo string) string {
+	return strings.ReplaceAll(strings.Trim(repo, "/"), "/", "_") + ".patch"
+}
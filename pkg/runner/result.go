@@ -0,0 +1,132 @@
+package runner
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// RepoStatus describes the outcome of running the pipeline against a single repository.
+type RepoStatus string
+
+const (
+	// RepoStatusSucceeded indicates the changes were committed and pushed.
+	RepoStatusSucceeded RepoStatus = "succeeded"
+	// RepoStatusNoOp indicates the steps ran successfully but did not change anything.
+	RepoStatusNoOp RepoStatus = "no-op"
+	// RepoStatusChanged indicates a dry run changed the repository. Nothing was committed or pushed.
+	RepoStatusChanged RepoStatus = "changed"
+	// RepoStatusFailed indicates the pipeline could not be completed for the repository.
+	RepoStatusFailed RepoStatus = "failed"
+	// RepoStatusSkipped indicates the steps were not run for the repository, either because it didn't meet the
+	// preconditions of the pipeline or because the run stopped before reaching it.
+	RepoStatusSkipped RepoStatus = "skipped"
+)
+
+// RepoResult is the outcome of running the pipeline against a single repository.
+type RepoResult struct {
+	Repo             string     `json:"repo"`
+	Status           RepoStatus `json:"status"`
+	Branch           string     `json:"branch,omitempty"`
+	CommitSHA        string     `json:"commit_sha,omitempty"`
+	ChangeRequestURL string     `json:"change_request_url,omitempty"`
+	FailedStep       string     `json:"failed_step,omitempty"`
+	SkipReason       string     `json:"skip_reason,omitempty"`
+	Diff             string     `json:"diff,omitempty"`
+	DiffStat         string     `json:"diff_stat,omitempty"`
+	PatchFile        string     `json:"patch_file,omitempty"`
+	Steps            []Result   `json:"steps"`
+	Error            error      `json:"-"`
+}
+
+// Summary returns a one line description of the outcome, e.g. "failed at step run tests".
+func (r RepoResult) Summary() string {
+	if r.Status == RepoStatusFailed && r.FailedStep != "" {
+		return fmt.Sprintf("%s at step %s", r.Status, r.FailedStep)
+	}
+	if r.Status == RepoStatusSkipped && r.SkipReason != "" {
+		return fmt.Sprintf("%s (%s)", r.Status, r.SkipReason)
+	}
+	return string(r.Status)
+}
+
+// StepStatus describes the outcome of a step or of a single attempt of a step.
+type StepStatus string
+
+const (
+	// StepStatusSucceeded indicates the step completed with a zero exit code.
+	StepStatusSucceeded StepStatus = "succeeded"
+	// StepStatusFailed indicates the step failed.
+	StepStatusFailed StepStatus = "failed"
+	// StepStatusTimedOut indicates the step was killed because it exceeded its timeout.
+	StepStatusTimedOut StepStatus = "timed-out"
+	// StepStatusSkipped indicates the step didn't run because its if expression was false.
+	StepStatusSkipped StepStatus = "skipped"
+)
+
+// ErrStepTimeout indicates a step exceeded its timeout.
+var ErrStepTimeout = errors.New("step timed out")
+
+// Attempt is a single execution of a step.
+type Attempt struct {
+	Number   int           `json:"number"`
+	Status   StepStatus    `json:"status"`
+	ExitCode int           `json:"exit_code"`
+	Error    error         `json:"-"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Result is the outcome of running a single step against a repository. When a step is retried, the fields describe
+// the last attempt.
+type Result struct {
+	Repo        string        `json:"repo"`
+	StepName    string        `json:"step"`
+	Status      StepStatus    `json:"status"`
+	ContainerID string        `json:"container_id,omitempty"`
+	ExitCode    int           `json:"exit_code"`
+	Changed     bool          `json:"changed"`
+	Stdout      string        `json:"stdout,omitempty"`
+	Stderr      string        `json:"stderr,omitempty"`
+	StartedAt   time.Time     `json:"started_at"`
+	FinishedAt  time.Time     `json:"finished_at"`
+	Error       error         `json:"-"`
+	Duration    time.Duration `json:"duration"`
+	Attempts    []Attempt     `json:"attempts,omitempty"`
+	// Outputs are the key=value pairs the step wrote to $METAMORPH_OUTPUT.
+	Outputs map[string]string `json:"outputs,omitempty"`
+}
+
+// MarshalJSON encodes the result with the error as a string.
+func (r RepoResult) MarshalJSON() ([]byte, error) {
+	type alias RepoResult
+	return json.Marshal(struct {
+		alias
+		Error string `json:"error,omitempty"`
+	}{alias(r), errorString(r.Error)})
+}
+
+// MarshalJSON encodes the attempt with the error as a string.
+func (a Attempt) MarshalJSON() ([]byte, error) {
+	type alias Attempt
+	return json.Marshal(struct {
+		alias
+		Error string `json:"error,omitempty"`
+	}{alias(a), errorString(a.Error)})
+}
+
+// MarshalJSON encodes the result with the error as a string.
+func (r Result) MarshalJSON() ([]byte, error) {
+	type alias Result
+	return json.Marshal(struct {
+		alias
+		Error string `json:"error,omitempty"`
+	}{alias(r), errorString(r.Error)})
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,73 @@
+package runner
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepoResultMarshalJSON(t *testing.T) {
+	t.Parallel()
+
+	startedAt := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	result := RepoResult{
+		Repo:   "backend/es-indexer",
+		Status: RepoStatusFailed,
+		Steps: []Result{{
+			Repo:       "backend/es-indexer",
+			StepName:   "run tests",
+			Status:     StepStatusFailed,
+			ExitCode:   2,
+			Stdout:     "running tests\n",
+			Stderr:     "1 test failed\n",
+			StartedAt:  startedAt,
+			FinishedAt: startedAt.Add(time.Second),
+			Error:      errors.New("script exited with status code 2"),
+			Duration:   time.Second,
+			Attempts: []Attempt{
+				{Number: 1, Status: StepStatusFailed, ExitCode: 2, Error: errors.New("script exited with status code 2")},
+			},
+		}},
+		Error: errors.New("step execution failed"),
+	}
+
+	data, err := json.Marshal(result)
+	require.NoError(t, err)
+
+	var decoded map[string]any
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	require.Equal(t, "backend/es-indexer", decoded["repo"])
+	require.Equal(t, "failed", decoded["status"])
+	require.Equal(t, "step execution failed", decoded["error"])
+
+	step := decoded["steps"].([]any)[0].(map[string]any)
+	require.Equal(t, "run tests", step["step"])
+	require.Equal(t, float64(2), step["exit_code"])
+	require.Equal(t, "running tests\n", step["stdout"])
+	require.Equal(t, "1 test failed\n", step["stderr"])
+	require.Equal(t, "2025-01-02T03:04:05Z", step["started_at"])
+	require.Equal(t, "script exited with status code 2", step["error"])
+
+	attempt := step["attempts"].([]any)[0].(map[string]any)
+	require.Equal(t, "script exited with status code 2", attempt["error"])
+}
+
+func TestRepoResultSummary(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, "succeeded", RepoResult{Status: RepoStatusSucceeded}.Summary())
+	require.Equal(t, "no-op", RepoResult{Status: RepoStatusNoOp}.Summary())
+	require.Equal(t, "skipped", RepoResult{Status: RepoStatusSkipped}.Summary())
+	require.Equal(t, "failed", RepoResult{Status: RepoStatusFailed}.Summary())
+	require.Equal(t, "failed at step run tests", RepoResult{Status: RepoStatusFailed, FailedStep: "run tests"}.Summary())
+}
+
+func TestPatchFileName(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, "es-indexer.patch", patchFileName("es-indexer"))
+	require.Equal(t, "backend_es-indexer.patch", patchFileName("backend/es-indexer"))
+}
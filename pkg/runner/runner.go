@@ -5,19 +5,19 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
-	"strings"
 	"sync"
 	"time"
 
 	"go.uber.org/zap"
 
 	"github.com/brightfame/metamorph/internal/config"
-	"github.com/brightfame/metamorph/internal/fileutil"
 	"github.com/brightfame/metamorph/pkg/container"
+	"github.com/brightfame/metamorph/pkg/executor"
 	"github.com/brightfame/metamorph/pkg/git"
 	"github.com/brightfame/metamorph/pkg/pipeline"
-	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/brightfame/metamorph/pkg/scm"
 )
 
 // Runner executes a pipeline of tasks
@@ -26,166 +26,496 @@ type Runner struct {
 	errChan  chan error
 	doneChan chan bool
 	mutex    sync.Mutex
-	cr       container.Runtime
+	// executors run the steps, keyed by type.
+	executors map[executor.Type]executor.Executor
+	// runtime runs the containers of the container executor. It is created from the config unless set by an Option.
+	runtime container.Runtime
+	// platform is created from the config unless set by an Option.
+	platform scm.Platform
 	cfg      *config.Config
 }
 
-type Result struct {
-	StepName string
-	ExitCode int
-	Output   []byte
-	Error    error
-	Duration time.Duration
+// Option configures a Runner.
+type Option func(*Runner)
+
+// WithRuntime makes the runner run containers with the given runtime instead of the one of the config.
+func WithRuntime(runtime container.Runtime) Option {
+	return func(r *Runner) {
+		r.runtime = runtime
+	}
+}
+
+// WithPlatform makes the runner clone, push and open change requests with the given platform instead of the one of
+// the config.
+func WithPlatform(platform scm.Platform) Option {
+	return func(r *Runner) {
+		r.platform = platform
+	}
 }
 
 // New creates a new Runner instance
-func New(cfg *config.Config, p *pipeline.Pipeline) *Runner {
-	return &Runner{
+func New(cfg *config.Config, p *pipeline.Pipeline, opts ...Option) *Runner {
+	r := &Runner{
 		p:        p,
 		errChan:  make(chan error, 1),
 		doneChan: make(chan bool, 1),
 		cfg:      cfg,
 	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
 }
 
 // Run executes all steps in the pipeline
-func (r *Runner) Run(ctx context.Context) ([]Result, error) {
-	// create the container runtime instance
-	rt, err := container.ParseRuntimeType(r.cfg.ContainerRuntime)
-	if err != nil {
-		return nil, err
+func (r *Runner) Run(ctx context.Context) ([]RepoResult, error) {
+	// create the executors, running steps in containers of the container runtime or on the host
+	if r.runtime == nil {
+		rt, err := container.ParseRuntimeType(r.cfg.ContainerRuntime)
+		if err != nil {
+			return nil, err
+		}
+
+		if r.runtime, err = container.NewRuntime(rt, r.cfg); err != nil {
+			return nil, err
+		}
+	}
+	r.executors = map[executor.Type]executor.Executor{
+		executor.ContainerType: executor.NewContainerExecutor(r.runtime, r.cfg.DefaultContainerRepoPath, r.cfg.Logger),
+		executor.LocalType:     executor.NewLocalExecutor(r.cfg.Logger),
+	}
+	for et, exec := range r.executors {
+		if err := exec.Initialize(ctx); err != nil {
+			return nil, fmt.Errorf("unable to initialize the %s executor: %w", et, err)
+		}
+	}
+	defer func() {
+		for et, exec := range r.executors {
+			if err := exec.Cleanup(context.Background()); err != nil {
+				r.cfg.Logger.Warnf("Unable to clean up the %s executor: %v", et, err)
+			}
+		}
+	}()
+
+	// create the SCM platform instance
+	if r.platform == nil {
+		pt, err := scm.ParsePlatformType(r.cfg.Platform)
+		if err != nil {
+			return nil, err
+		}
+
+		if r.platform, err = scm.NewPlatform(pt, r.cfg); err != nil {
+			return nil, err
+		}
 	}
 
-	runtime, err := container.NewRuntime(rt, r.cfg)
+	r.cfg.Logger.Infof("Starting pipeline execution", "steps", len(r.p.Steps))
+
+	return r.runRepos(ctx)
+}
+
+// runRepos executes the pipeline for each repo using a bounded pool of workers. The steps of a single repo are
+// always executed in order. With the fail-fast policy the first failure cancels the repos that are still running and
+// skips the ones that haven't started yet; with the continue policy every repo runs regardless of failures.
+func (r *Runner) runRepos(ctx context.Context) ([]RepoResult, error) {
+	policy, err := ParseFailurePolicy(r.cfg.FailurePolicy)
 	if err != nil {
 		return nil, err
 	}
-	r.cr = runtime
 
-	r.cfg.Logger.Infof("Starting pipeline execution", "steps", len(r.p.Steps))
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
-	results := make([]Result, 0, len(r.p.Steps))
+	parallelism := r.cfg.Parallelism
+	if parallelism < 1 {
+		parallelism = 1
+	}
 
-	// execute the pipeline for each repo
-	for _, repo := range r.cfg.Repos {
-		repoLogger := r.cfg.Logger.With("repo", repo)
-		repoLogger.Info("Starting pipeline execution for %s", repo)
+	var (
+		wg       sync.WaitGroup
+		sem      = make(chan struct{}, parallelism)
+		results  = make([]*RepoResult, len(r.cfg.Repos))
+		firstErr error
+	)
+
+	for i, repo := range r.cfg.Repos {
+		select {
+		case <-ctx.Done():
+		case sem <- struct{}{}:
+		}
+		if ctx.Err() != nil {
+			break
+		}
 
-		for i, step := range r.p.Steps {
-			stepLogger := repoLogger.With("step", step.Name, "step_number", i+1)
-			stepLogger.Infof("Executing", "commands", step.Commands())
+		wg.Add(1)
+		go func(i int, repo config.Repo) {
+			defer wg.Done()
+			defer func() { <-sem }()
 
-			// set defaults
-			if step.WorkDir == "" {
-				step.WorkDir = r.p.WorkDir
+			result, err := r.runRepo(ctx, repo)
+			if err != nil {
+				result.Status = RepoStatusFailed
+				result.Error = err
 			}
 
-			select {
-			case <-ctx.Done():
-				return results, ctx.Err()
-			default:
-				// execute the step
-				start := time.Now()
-				result, err := r.executeStepImpl(ctx, repo, step, stepLogger)
-				duration := time.Since(start)
-
-				if err != nil {
-					return results, fmt.Errorf("step execution failed: %w", err)
-				}
+			r.mutex.Lock()
+			defer r.mutex.Unlock()
+			results[i] = &result
+			if err != nil && firstErr == nil && policy == FailFast {
+				firstErr = err
+				cancel()
+			}
+		}(i, repo)
+	}
 
-				stepLogger.Infof("Step completed successfully", "duration", duration, "exit_code", result.ExitCode)
+	wg.Wait()
 
-				results = append(results, result)
+	// repos that were never started because of an earlier failure or cancellation are reported as skipped
+	out := make([]RepoResult, 0, len(results))
+	for i, result := range results {
+		if result == nil {
+			result = &RepoResult{
+				Repo:   r.cfg.Repos[i].Name,
+				Status: RepoStatusSkipped,
+				Steps:  []Result{},
 			}
 		}
+		out = append(out, *result)
 	}
 
-	return results, nil
+	if firstErr == nil && ctx.Err() != nil {
+		firstErr = ctx.Err()
+	}
+
+	return out, firstErr
 }
 
-func (r *Runner) executeStepImpl(ctx context.Context, repoName string, step pipeline.Step, logger *zap.SugaredLogger) (Result, error) {
-	image := container.ParseDockerImage(step.Image)
+// runRepo clones the repo once, executes every step of the pipeline against the same workspace and then publishes
+// any changes the steps made.
+func (r *Runner) runRepo(ctx context.Context, repo config.Repo) (RepoResult, error) {
+	repoLogger := r.cfg.Logger.With("repo", repo.Name)
+	repoLogger.Infof("Starting pipeline execution for %s", repo.Name)
 
-	// ensure the container image exists and pull it if necessary
-	err := r.cr.PullImage(ctx, image)
-	if errors.Is(err, container.ErrImageExists) {
-		logger.Debugf("Image %s already exists.", image)
-	} else if err != nil {
-		return Result{}, err
+	result := RepoResult{
+		Repo:  repo.Name,
+		Steps: make([]Result, 0, len(r.p.Steps)),
 	}
 
-	cConfig := &container.Config{
-		Image:        image,
-		Cmd:          step.Commands(),
-		Tty:          false,
-		WorkingDir:   r.cfg.DefaultContainerRepoPath,
-		AttachStdout: true,
-		AttachStderr: true,
-		Env:          step.Env,
+	ws, err := r.prepareWorkspace(ctx, repo, repoLogger)
+	if err != nil {
+		return result, fmt.Errorf("unable to prepare workspace for %s: %w", repo.Name, err)
 	}
+	defer r.cleanupWorkspace(ws, repoLogger)
 
-	// process any volume mounts
-	mounts := make([]container.Mount, 0)
-	for _, volume := range step.Volumes {
-		// volumes are stored in the format source:target, so we need to split them
-		mount := strings.Split(volume, ":")
+	// evaluate the preconditions before starting any containers
+	matched, reason, err := r.p.Matches(ws.Path)
+	if err != nil {
+		return result, fmt.Errorf("unable to evaluate preconditions for %s: %w", repo.Name, err)
+	}
+	if !matched {
+		repoLogger.Infof("Skipping %s: %s", repo.Name, reason)
+		result.Status = RepoStatusSkipped
+		result.SkipReason = reason
+		return result, nil
+	}
+
+	// the context step conditions are evaluated against, updated after every step
+	exprCtx := &pipeline.ExpressionContext{
+		RepoPath: ws.Path,
+		Repo: pipeline.RepoContext{
+			Name:       repo.Name,
+			Path:       path.Join(r.cfg.PlatformOrg, repo.Name),
+			BaseBranch: ws.BaseBranch,
+		},
+		Vars:  ws.Vars,
+		Steps: make(map[string]pipeline.StepContext, len(r.p.Steps)),
+	}
+	fingerprint, err := git.WorktreeFingerprint(ws.Path)
+	if err != nil {
+		return result, err
+	}
 
-		// ensure the source path is absolute
-		sourceAbs, err := filepath.Abs(mount[0])
+	for i, step := range r.p.Steps {
+		stepLogger := repoLogger.With("step", step.Name, "step_number", i+1)
+		exprCtx.Params = step.Params()
+
+		if condition := step.Condition(); condition != nil {
+			run, err := condition.Eval(exprCtx)
+			if err != nil {
+				result.FailedStep = step.Name
+				return result, fmt.Errorf("unable to evaluate the if expression of step %s: %w", step.Name, err)
+			}
+			if !run {
+				stepLogger.Infof("Skipping step, if expression %q is false", condition)
+				result.Steps = append(result.Steps, Result{Repo: repo.Name, StepName: step.Name, Status: StepStatusSkipped})
+				exprCtx.Steps[step.Name] = pipeline.StepContext{Outcome: string(StepStatusSkipped)}
+				continue
+			}
+		}
+
+		// expand the templates of the step, which may refer to the outputs of previous steps
+		rendered, err := step.Render(exprCtx, r.p.Strict)
 		if err != nil {
-			return Result{}, err
+			result.FailedStep = step.Name
+			return result, fmt.Errorf("step %s: %w", step.Name, err)
 		}
+		rendered.Env = stepEnv(rendered, ws.Vars, result.Steps)
 
-		mounts = append(mounts, container.Mount{
-			Source: sourceAbs,
-			Target: mount[1],
-		})
+		stepLogger.Infof("Executing", "commands", rendered.Commands())
+
+		// set defaults
+		if rendered.WorkDir == "" {
+			rendered.WorkDir = r.p.WorkDir
+		}
+
+		select {
+		case <-ctx.Done():
+			return result, ctx.Err()
+		default:
+			// execute the step
+			stepResult, err := r.executeStep(ctx, ws, rendered, stepLogger)
+
+			// record whether the step changed the worktree for the conditions of later steps
+			newFingerprint, fpErr := git.WorktreeFingerprint(ws.Path)
+			if fpErr != nil {
+				stepLogger.Warnf("Unable to detect changes made by the step: %v", fpErr)
+				newFingerprint = fingerprint
+			}
+			stepResult.Changed = newFingerprint != fingerprint
+			fingerprint = newFingerprint
+			exprCtx.Changed = fingerprint != ""
+			exprCtx.Steps[rendered.Name] = pipeline.StepContext{
+				Outcome:  string(stepResult.Status),
+				ExitCode: stepResult.ExitCode,
+				Changed:  stepResult.Changed,
+				Outputs:  stepResult.Outputs,
+			}
+
+			result.Steps = append(result.Steps, stepResult)
+
+			if err != nil && rendered.ContinueOnError && ctx.Err() == nil {
+				stepLogger.Warnf("Step failed, continuing because continue_on_error is set: %v", err)
+				continue
+			}
+			if err != nil {
+				result.FailedStep = rendered.Name
+				return result, fmt.Errorf("step %s failed: %w", rendered.Name, err)
+			}
+
+			stepLogger.Infof("Step completed successfully", "duration", stepResult.Duration, "exit_code", stepResult.ExitCode)
+		}
 	}
 
-	// clone the repo
-	repoDestPath, err := os.MkdirTemp("", "metamorph-")
+	// render the branch and change request once the outputs of every step are known. Dry runs render them too, so
+	// that template errors show up before anything is pushed.
+	exprCtx.Params = nil
+	pub, err := r.p.RenderPublication(exprCtx)
 	if err != nil {
-		return Result{}, err
-	}
-	repoUrlFormatted := fmt.Sprintf("https://%s.com/%s/%s.git", r.cfg.Platform, r.cfg.PlatformOrg, repoName)
-	cloneOpts := git.CloneOptions{
-		URL:         repoUrlFormatted,
-		Branch:      "",
-		Destination: repoDestPath,
-		Auth: &http.BasicAuth{
-			Username: r.cfg.PlatformAuthConfig.Username,
-			Password: r.cfg.PlatformAuthConfig.Password,
-		},
+		return result, err
+	}
+
+	if r.cfg.DryRun {
+		if err := r.preview(ws, pub, &result, repoLogger); err != nil {
+			return result, err
+		}
+		return result, nil
+	}
+
+	if err := r.publish(ctx, ws, pub, &result, repoLogger); err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// stepEnv returns the environment of the step, which includes the outputs of the previous steps. Variables of the
+// repo take precedence over the step's environment.
+func stepEnv(step pipeline.Step, vars map[string]string, previous []Result) map[string]string {
+	env := outputEnv(previous)
+	for k, v := range step.Env {
+		env[k] = v
+	}
+	for k, v := range vars {
+		env[k] = v
+	}
+	return env
+}
+
+// withEnv returns a copy of env with the given variable set.
+func withEnv(env map[string]string, key, value string) map[string]string {
+	out := make(map[string]string, len(env)+1)
+	for k, v := range env {
+		out[k] = v
+	}
+	out[key] = value
+	return out
+}
+
+// executeStep executes the step, retrying failed attempts according to the step's retry policy.
+func (r *Runner) executeStep(ctx context.Context, ws *workspace, step pipeline.Step, logger *zap.SugaredLogger) (Result, error) {
+	maxAttempts := step.Retry.Attempts()
+	start := time.Now()
+
+	var (
+		result Result
+		err    error
+	)
+	outputFile, err := newOutputFile(ws)
+	if err != nil {
+		return Result{Repo: ws.Repo, StepName: step.Name, Status: StepStatusFailed, ExitCode: -1, Error: err}, err
+	}
+
+	attempts := make([]Attempt, 0, maxAttempts)
+retry:
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		// every attempt starts with an empty output file
+		if err := os.Truncate(outputFile, 0); err != nil {
+			return Result{Repo: ws.Repo, StepName: step.Name, Status: StepStatusFailed, ExitCode: -1, Error: err}, err
+		}
+
+		attemptStart := time.Now()
+		result, err = r.executeStepImpl(ctx, ws, step, outputFile, logger)
+		attempts = append(attempts, Attempt{
+			Number:   attempt,
+			Status:   result.Status,
+			ExitCode: result.ExitCode,
+			Error:    err,
+			Duration: time.Since(attemptStart),
+		})
+
+		// don't retry successful steps or runs that were cancelled
+		if err == nil || ctx.Err() != nil || attempt == maxAttempts {
+			break
+		}
+
+		delay := step.Retry.Delay(attempt)
+		logger.Warnf("Attempt %d of %d failed, retrying in %s: %v", attempt, maxAttempts, delay, err)
+		select {
+		case <-ctx.Done():
+			// the run was cancelled while waiting, so there is no next attempt
+			break retry
+		case <-time.After(delay):
+		}
+	}
+
+	result.Repo = ws.Repo
+	result.StepName = step.Name
+	result.Duration = time.Since(start)
+	result.Attempts = attempts
+
+	outputs, outputErr := readOutputs(outputFile)
+	if outputErr != nil && err == nil {
+		result.Status = StepStatusFailed
+		err = outputErr
 	}
+	result.Outputs = outputs
+	result.Error = err
+
+	return result, err
+}
 
-	r.cfg.Logger.Infof("Cloning repo %s", repoUrlFormatted)
-	err = git.Clone(cloneOpts)
+// executeStepImpl runs a single attempt of the step with the executor of the step.
+func (r *Runner) executeStepImpl(ctx context.Context, ws *workspace, step pipeline.Step, outputFile string, logger *zap.SugaredLogger) (Result, error) {
+	et, err := r.executorType(step)
 	if err != nil {
-		return Result{}, err
+		return Result{Status: StepStatusFailed, ExitCode: -1}, err
+	}
+	exec, ok := r.executors[et]
+	if !ok {
+		return Result{Status: StepStatusFailed, ExitCode: -1}, fmt.Errorf("no %s executor available", et)
 	}
 
-	// explicitly add a mount for the repo root
-	repoRootPath := fileutil.RepoRootPath(repoDestPath, logger)
-	mounts = append(mounts, container.Mount{
-		Source: repoRootPath,
-		Target: r.cfg.DefaultContainerRepoPath,
-	})
+	config := executor.ExecutionConfig{
+		WorkDir: ws.Path,
+		Command: step.Commands(),
+		Timeout: step.TimeoutDuration(),
+		Image:   step.Image,
+		User:    step.User,
+		Logger:  logger,
+	}
+	if et == executor.ContainerType {
+		// process any volume mounts and add one for the step output files
+		mounts, err := volumeMounts(step)
+		if err != nil {
+			return Result{Status: StepStatusFailed, ExitCode: -1}, err
+		}
+		config.Mounts = append(mounts, container.Mount{
+			Source: ws.OutputDir,
+			Target: OutputMountPath,
+		})
+		config.Environment = withEnv(step.Env, OutputEnvVar, outputContainerPath(outputFile))
+	} else {
+		config.Environment = withEnv(step.Env, OutputEnvVar, outputFile)
+	}
 
-	hostConfig := &container.HostConfig{
-		Mounts: mounts,
+	execResult, err := exec.Execute(ctx, config)
+	result := newResult(execResult)
+	switch {
+	case err == nil:
+		result.Status = StepStatusSucceeded
+	case errors.Is(err, executor.ErrTimeout):
+		result.Status = StepStatusTimedOut
+		return result, fmt.Errorf("%w after %s", ErrStepTimeout, step.TimeoutDuration())
+	default:
+		result.Status = StepStatusFailed
 	}
+	return result, err
+}
 
-	if err := r.cr.Run(ctx, "", cConfig, hostConfig); err != nil {
-		return Result{}, err
+// executorType returns the type of executor that runs the step, falling back to the executor of the run and then to
+// the container executor.
+func (r *Runner) executorType(step pipeline.Step) (executor.Type, error) {
+	name := step.Executor
+	if name == "" {
+		name = r.cfg.Executor
+	}
+	if name == "" {
+		return executor.ContainerType, nil
+	}
+	return executor.ParseType(name)
+}
+
+// volumeMounts converts the volumes of the step into container mounts. Bind mounts with a relative source, which
+// only occur in pipelines that weren't loaded from a manifest file, are resolved against the working directory.
+func volumeMounts(step pipeline.Step) ([]container.Mount, error) {
+	volumes, err := step.ParsedVolumes()
+	if err != nil {
+		return nil, err
+	}
+
+	mounts := make([]container.Mount, 0, len(volumes))
+	for _, v := range volumes {
+		m := container.Mount{
+			Type:     container.MountType(v.Type),
+			Source:   v.Source,
+			Target:   v.Target,
+			ReadOnly: v.ReadOnly,
+		}
+		if v.Type == pipeline.VolumeBind {
+			if m.Source, err = filepath.Abs(v.Source); err != nil {
+				return nil, err
+			}
+		}
+		mounts = append(mounts, m)
+	}
+	return mounts, nil
+}
+
+// newResult creates a step result from the result of the execution, which may be nil if the command could not be
+// started.
+func newResult(er *executor.ExecutionResult) Result {
+	if er == nil {
+		return Result{ExitCode: -1}
 	}
 
 	return Result{
-		StepName: step.Name,
-		ExitCode: 0,
-		Output:   nil,
-		Error:    nil,
-		Duration: 0,
-	}, nil
+		ContainerID: er.ContainerID,
+		ExitCode:    er.ExitCode,
+		Stdout:      er.Stdout,
+		Stderr:      er.Stderr,
+		StartedAt:   er.StartedAt,
+		FinishedAt:  er.FinishedAt,
+	}
 }
 
 // RunAsync executes all steps in the pipeline asynchronously
@@ -0,0 +1,531 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/brightfame/metamorph/internal/config"
+	"github.com/brightfame/metamorph/pkg/container"
+	"github.com/brightfame/metamorph/pkg/container/containertest"
+	"github.com/brightfame/metamorph/pkg/executor"
+	"github.com/brightfame/metamorph/pkg/pipeline"
+)
+
+// fakeExecutor records the executions and returns the results of execute.
+type fakeExecutor struct {
+	executions []executor.ExecutionConfig
+	execute    func(config executor.ExecutionConfig, attempt int) (*executor.ExecutionResult, error)
+}
+
+func (f *fakeExecutor) Initialize(ctx context.Context) error { return nil }
+
+func (f *fakeExecutor) Execute(ctx context.Context, config executor.ExecutionConfig) (*executor.ExecutionResult, error) {
+	f.executions = append(f.executions, config)
+	return f.execute(config, len(f.executions))
+}
+
+func (f *fakeExecutor) Cleanup(ctx context.Context) error { return nil }
+
+func (f *fakeExecutor) GetLogs(ctx context.Context) (io.Reader, error) {
+	return strings.NewReader(""), nil
+}
+
+func TestExecuteStepInContainer(t *testing.T) {
+	t.Parallel()
+
+	p := loadTestPipeline(t, `steps:
+  - name: detect
+    image: node:22
+    run: echo "node_version=$(node --version)" >> "$METAMORPH_OUTPUT"
+    volumes:
+      - go-cache:/cache
+    user: root
+    retry:
+      max_attempts: 2
+`)
+	ws := newTestWorkspace(t)
+
+	fake := &fakeExecutor{
+		execute: func(config executor.ExecutionConfig, attempt int) (*executor.ExecutionResult, error) {
+			if attempt == 1 {
+				return &executor.ExecutionResult{ExitCode: 1, Stderr: "flaky"}, &executor.ExitError{ExitCode: 1}
+			}
+			// write the output like the container would, through the output mount
+			outputDir := config.Mounts[len(config.Mounts)-1].Source
+			outputFile := filepath.Join(outputDir, filepath.Base(config.Environment[OutputEnvVar]))
+			require.NoError(t, os.WriteFile(outputFile, []byte("node_version=22.10.5\n"), 0o644))
+			return &executor.ExecutionResult{ContainerID: "abc123", Stdout: "ok\n"}, nil
+		},
+	}
+	r := &Runner{
+		p:         p,
+		cfg:       &config.Config{Executor: executor.ContainerType.String()},
+		executors: map[executor.Type]executor.Executor{executor.ContainerType: fake},
+	}
+
+	result, err := r.executeStep(context.Background(), ws, p.Steps[0], zap.NewNop().Sugar())
+	require.NoError(t, err)
+	require.Equal(t, StepStatusSucceeded, result.Status)
+	require.Equal(t, "abc123", result.ContainerID)
+	require.Equal(t, "ok\n", result.Stdout)
+	require.Len(t, result.Attempts, 2)
+	require.Equal(t, StepStatusFailed, result.Attempts[0].Status)
+	require.Equal(t, map[string]string{"node_version": "22.10.5"}, result.Outputs)
+
+	config := fake.executions[1]
+	require.Equal(t, "node:22", config.Image)
+	require.Equal(t, "root", config.User)
+	require.Equal(t, ws.Path, config.WorkDir)
+	require.True(t, strings.HasPrefix(config.Environment[OutputEnvVar], OutputMountPath+"/"))
+	require.Equal(t, []container.Mount{
+		{Type: container.MountTypeVolume, Source: "go-cache", Target: "/cache"},
+		{Source: ws.OutputDir, Target: OutputMountPath},
+	}, config.Mounts)
+}
+
+func TestExecuteStepCancelledDuringRetryDelay(t *testing.T) {
+	t.Parallel()
+
+	p := loadTestPipeline(t, `steps:
+  - name: flaky
+    image: alpine
+    command: ./flaky.sh
+    retry:
+      max_attempts: 3
+      interval: 1m
+`)
+	ws := newTestWorkspace(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fake := &fakeExecutor{
+		execute: func(config executor.ExecutionConfig, attempt int) (*executor.ExecutionResult, error) {
+			// cancel the run while the runner waits for the next attempt
+			time.AfterFunc(50*time.Millisecond, cancel)
+			return &executor.ExecutionResult{ExitCode: 1}, &executor.ExitError{ExitCode: 1}
+		},
+	}
+	r := &Runner{
+		p:         p,
+		cfg:       &config.Config{},
+		executors: map[executor.Type]executor.Executor{executor.ContainerType: fake},
+	}
+
+	result, err := r.executeStep(ctx, ws, p.Steps[0], zap.NewNop().Sugar())
+	require.Error(t, err)
+	require.Len(t, fake.executions, 1)
+	require.Len(t, result.Attempts, 1)
+	require.Equal(t, 1, result.ExitCode)
+	require.Less(t, result.Duration, time.Minute)
+}
+
+func TestExecuteStepLocally(t *testing.T) {
+	t.Parallel()
+
+	p := loadTestPipeline(t, `steps:
+  - name: bump
+    executor: local
+    command: sed -i s/16/22/ .nvmrc
+    timeout: 1500ms
+  - name: slow
+    image: alpine
+    command: sleep 60
+    timeout: 1s
+`)
+	ws := newTestWorkspace(t)
+
+	fake := &fakeExecutor{
+		execute: func(config executor.ExecutionConfig, attempt int) (*executor.ExecutionResult, error) {
+			if attempt == 2 {
+				return &executor.ExecutionResult{ExitCode: -1}, executor.ErrTimeout
+			}
+			return &executor.ExecutionResult{}, nil
+		},
+	}
+	// the container executor is not used for steps that choose the local executor, nor by runs that default to it
+	r := &Runner{
+		p:         p,
+		cfg:       &config.Config{Executor: executor.ContainerType.String()},
+		executors: map[executor.Type]executor.Executor{executor.LocalType: fake},
+	}
+
+	result, err := r.executeStep(context.Background(), ws, p.Steps[0], zap.NewNop().Sugar())
+	require.NoError(t, err)
+	require.Equal(t, StepStatusSucceeded, result.Status)
+	require.Equal(t, 1500*time.Millisecond, fake.executions[0].Timeout)
+	require.Empty(t, fake.executions[0].Mounts)
+	require.Equal(t, ws.OutputDir, filepath.Dir(fake.executions[0].Environment[OutputEnvVar]))
+
+	_, err = r.executeStep(context.Background(), ws, p.Steps[1], zap.NewNop().Sugar())
+	require.ErrorContains(t, err, "no container executor available")
+
+	r.cfg.Executor = executor.LocalType.String()
+	result, err = r.executeStep(context.Background(), ws, p.Steps[1], zap.NewNop().Sugar())
+	require.ErrorIs(t, err, ErrStepTimeout)
+	require.Equal(t, StepStatusTimedOut, result.Status)
+
+	// an unknown executor is an error rather than falling back to containers
+	r.cfg.Executor = "ssh"
+	_, err = r.executeStep(context.Background(), ws, p.Steps[1], zap.NewNop().Sugar())
+	require.ErrorContains(t, err, `unknown executor type "ssh"`)
+}
+
+func TestRunWithLocalExecutor(t *testing.T) {
+	t.Parallel()
+
+	remote := containertest.NewRemote(t)
+	remote.AddRepo(t, "backend/es-indexer", map[string]string{".nvmrc": "16\n"})
+	runtime := containertest.NewRuntime()
+
+	cfg := newTestConfig(t, config.Repo{Name: "backend/es-indexer"})
+	cfg.Executor = executor.LocalType.String()
+	cfg.DryRun = true
+
+	// steps don't need an image when the run uses the local executor
+	path := filepath.Join(t.TempDir(), "manifest.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`steps:
+  - name: bump
+    command: echo 22 > .nvmrc
+`), 0o644))
+	p, err := pipeline.LoadManifestFile(cfg, path)
+	require.NoError(t, err)
+
+	results, err := New(cfg, p, WithRuntime(runtime), WithPlatform(remote)).Run(context.Background())
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.Equal(t, RepoStatusChanged, results[0].Status)
+	require.Contains(t, results[0].Diff, "+22")
+	require.Empty(t, runtime.Calls())
+}
+
+// loadTestPipeline loads the manifest from a temporary file.
+func loadTestPipeline(t *testing.T, manifest string) *pipeline.Pipeline {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "manifest.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(manifest), 0o644))
+	p, err := pipeline.LoadManifestFile(&config.Config{}, path)
+	require.NoError(t, err)
+	return p
+}
+
+// newTestWorkspace returns a workspace backed by temporary directories.
+func newTestWorkspace(t *testing.T) *workspace {
+	t.Helper()
+
+	return &workspace{
+		Repo:      "backend/es-indexer",
+		Path:      t.TempDir(),
+		OutputDir: t.TempDir(),
+	}
+}
+
+func TestRunPublishesChanges(t *testing.T) {
+	t.Parallel()
+
+	remote := containertest.NewRemote(t)
+	remote.AddRepo(t, "backend/es-indexer", map[string]string{".nvmrc": "16\n", "README.md": "# es-indexer\n"})
+	remote.AddRepo(t, "backend/billing", map[string]string{".nvmrc": "22\n"})
+
+	runtime := containertest.NewRuntime().
+		On(func(call containertest.Call) bool {
+			return call.Config.Env["NODE_VERSION"] == "16"
+		}, containertest.Response{
+			Stdout: "bumped\n",
+			Files: map[string]string{
+				".nvmrc":            "22\n",
+				"$METAMORPH_OUTPUT": "previous=16\n",
+			},
+		})
+
+	p := loadTestPipeline(t, `gitlab:
+  branch_name: "node-from-{{ .Steps.bump.Outputs.previous }}"
+  merge_request_title: Bump Node.js to 22
+steps:
+  - name: bump
+    image: node:22
+    run: ./bump-node.sh
+`)
+	cfg := newTestConfig(t,
+		config.Repo{Name: "backend/es-indexer", Vars: map[string]string{"NODE_VERSION": "16"}},
+		config.Repo{Name: "backend/billing", Vars: map[string]string{"NODE_VERSION": "22"}},
+	)
+
+	results, err := New(cfg, p, WithRuntime(runtime), WithPlatform(remote)).Run(context.Background())
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+
+	changed := results[0]
+	require.Equal(t, RepoStatusSucceeded, changed.Status)
+	require.Equal(t, "node-from-16", changed.Branch)
+	require.Equal(t, "https://scm.example.com/backend/es-indexer/-/merge_requests/1", changed.ChangeRequestURL)
+	require.Equal(t, "bumped\n", changed.Steps[0].Stdout)
+	require.Equal(t, "22\n", remote.ReadFile(t, "backend/es-indexer", "node-from-16", ".nvmrc"))
+	require.Equal(t, changed.CommitSHA, remote.Commit(t, "backend/es-indexer", "node-from-16").Hash.String())
+	require.Equal(t, "16\n", remote.ReadFile(t, "backend/es-indexer", "main", ".nvmrc"))
+
+	require.Equal(t, RepoStatusNoOp, results[1].Status)
+	require.False(t, remote.HasBranch("backend/billing", "node-from-16"))
+
+	requests := remote.ChangeRequests()
+	require.Len(t, requests, 1)
+	require.Equal(t, "backend/es-indexer", requests[0].Repo)
+	require.Equal(t, "main", requests[0].TargetBranch)
+	require.Equal(t, "Bump Node.js to 22", requests[0].Title)
+
+	calls := runtime.Calls()
+	require.Len(t, calls, 2)
+	for _, call := range calls {
+		require.Equal(t, "node:22", call.Config.Image.String())
+		require.Equal(t, cfg.DefaultContainerRepoPath, call.Config.WorkingDir)
+		// the runtime runs the container as the invoking user
+		require.Empty(t, call.Config.User)
+	}
+	require.Equal(t, []string{"node:22", "node:22"}, runtime.Pulls())
+}
+
+func TestRunDoesNotOverwriteForeignBranch(t *testing.T) {
+	t.Parallel()
+
+	remote := containertest.NewRemote(t)
+	remote.AddRepo(t, "backend/es-indexer", map[string]string{".nvmrc": "16\n"})
+	remote.AddBranch(t, "backend/es-indexer", "bump-node", "jane@example.com", map[string]string{".nvmrc": "20\n"})
+	foreign := remote.Commit(t, "backend/es-indexer", "bump-node").Hash
+
+	runtime := containertest.NewRuntime().
+		OnCommand("bump", containertest.Response{Files: map[string]string{".nvmrc": "22\n"}})
+
+	p := loadTestPipeline(t, `gitlab:
+  branch_name: bump-node
+steps:
+  - name: bump
+    image: node:22
+    run: ./bump-node.sh
+`)
+	cfg := newTestConfig(t, config.Repo{Name: "backend/es-indexer"})
+
+	results, err := New(cfg, p, WithRuntime(runtime), WithPlatform(remote)).Run(context.Background())
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.Equal(t, RepoStatusFailed, results[0].Status)
+	require.ErrorContains(t, results[0].Error, "refusing to overwrite")
+
+	require.Equal(t, foreign, remote.Commit(t, "backend/es-indexer", "bump-node").Hash)
+	require.Empty(t, remote.ChangeRequests())
+
+	// a branch that only has commits of metamorph, e.g. of a previous run, is replaced
+	remote.AddBranch(t, "backend/es-indexer", "bump-node-again", pipeline.DefaultCommitAuthorEmail, nil)
+	p = loadTestPipeline(t, `gitlab:
+  branch_name: bump-node-again
+steps:
+  - name: bump
+    image: node:22
+    run: ./bump-node.sh
+`)
+
+	results, err = New(cfg, p, WithRuntime(runtime), WithPlatform(remote)).Run(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, RepoStatusSucceeded, results[0].Status)
+	require.Equal(t, "22\n", remote.ReadFile(t, "backend/es-indexer", "bump-node-again", ".nvmrc"))
+}
+
+func TestRunDryRunWithFailures(t *testing.T) {
+	t.Parallel()
+
+	remote := containertest.NewRemote(t)
+	remote.AddRepo(t, "backend/es-indexer", map[string]string{"README.md": "# es-indexer\n"})
+	remote.AddRepo(t, "backend/billing", map[string]string{"README.md": "# billing\n"})
+
+	runtime := containertest.NewRuntime().
+		On(func(call containertest.Call) bool {
+			return call.Config.Env["BROKEN"] == "true"
+		}, containertest.Response{ExitCode: 2, Stderr: "migration failed\n"}).
+		OnCommand("migrate", containertest.Response{
+			Files:  map[string]string{"docs/README.md": "# moved\n"},
+			Remove: []string{"README.md"},
+		})
+
+	p := loadTestPipeline(t, `steps:
+  - name: migrate
+    image: alpine
+    command: ./migrate.sh
+  - name: format
+    image: alpine
+    command: ./format.sh
+`)
+	cfg := newTestConfig(t,
+		config.Repo{Name: "backend/es-indexer"},
+		config.Repo{Name: "backend/billing", Vars: map[string]string{"BROKEN": "true"}},
+	)
+	cfg.DryRun = true
+	cfg.FailurePolicy = ContinueOnFailure.String()
+
+	results, err := New(cfg, p, WithRuntime(runtime), WithPlatform(remote)).Run(context.Background())
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+
+	require.Equal(t, RepoStatusChanged, results[0].Status)
+	require.Contains(t, results[0].Diff, "+# moved")
+	require.Len(t, results[0].Steps, 2)
+
+	require.Equal(t, RepoStatusFailed, results[1].Status)
+	require.Equal(t, "migrate", results[1].FailedStep)
+	require.Equal(t, 2, results[1].Steps[0].ExitCode)
+	require.Equal(t, "migration failed\n", results[1].Steps[0].Stderr)
+
+	// dry runs never push or open change requests
+	require.Empty(t, remote.ChangeRequests())
+	require.Len(t, runtime.Calls(), 3)
+}
+
+// concurrencyRuntime is a fake runtime that tracks how many containers run at the same time.
+type concurrencyRuntime struct {
+	*containertest.Runtime
+	mutex   sync.Mutex
+	running int
+	max     int
+}
+
+func (c *concurrencyRuntime) Run(ctx context.Context, containerID string, config *container.Config, hostConfig *container.HostConfig) (*container.RunResult, error) {
+	c.mutex.Lock()
+	c.running++
+	c.max = max(c.max, c.running)
+	c.mutex.Unlock()
+
+	defer func() {
+		c.mutex.Lock()
+		c.running--
+		c.mutex.Unlock()
+	}()
+
+	return c.Runtime.Run(ctx, containerID, config, hostConfig)
+}
+
+func TestRunReposInParallel(t *testing.T) {
+	t.Parallel()
+
+	remote := containertest.NewRemote(t)
+	repos := make([]config.Repo, 0, 5)
+	for i := 1; i <= 5; i++ {
+		name := fmt.Sprintf("backend/service-%d", i)
+		remote.AddRepo(t, name, map[string]string{"README.md": "# service\n"})
+		repos = append(repos, config.Repo{Name: name, Vars: map[string]string{"SERVICE": name}})
+	}
+
+	// the first repo finishes last, so the results must be ordered by repo rather than by completion
+	runtime := &concurrencyRuntime{Runtime: containertest.NewRuntime().
+		On(func(call containertest.Call) bool {
+			return call.Config.Env["SERVICE"] == "backend/service-1"
+		}, containertest.Response{Delay: 300 * time.Millisecond, Stdout: "backend/service-1\n"}).
+		On(func(call containertest.Call) bool {
+			return true
+		}, containertest.Response{Delay: 50 * time.Millisecond})}
+
+	p := loadTestPipeline(t, `steps:
+  - name: check
+    image: alpine
+    command: ./check.sh
+`)
+	cfg := newTestConfig(t, repos...)
+	cfg.Parallelism = 2
+
+	results, err := New(cfg, p, WithRuntime(runtime), WithPlatform(remote)).Run(context.Background())
+	require.NoError(t, err)
+	require.Len(t, results, len(repos))
+	for i, result := range results {
+		require.Equal(t, repos[i].Name, result.Repo)
+		require.Equal(t, RepoStatusNoOp, result.Status)
+	}
+	require.Equal(t, "backend/service-1\n", results[0].Steps[0].Stdout)
+
+	require.Len(t, runtime.Calls(), len(repos))
+	require.Equal(t, 2, runtime.max)
+}
+
+func TestRunFailFastSkipsRemainingRepos(t *testing.T) {
+	t.Parallel()
+
+	remote := containertest.NewRemote(t)
+	repos := make([]config.Repo, 0, 4)
+	for i := 1; i <= 4; i++ {
+		name := fmt.Sprintf("backend/service-%d", i)
+		remote.AddRepo(t, name, map[string]string{"README.md": "# service\n"})
+		repos = append(repos, config.Repo{Name: name, Vars: map[string]string{"SERVICE": name}})
+	}
+
+	runtime := containertest.NewRuntime().
+		On(func(call containertest.Call) bool {
+			return call.Config.Env["SERVICE"] == "backend/service-2"
+		}, containertest.Response{ExitCode: 1, Stderr: "check failed\n"})
+
+	p := loadTestPipeline(t, `steps:
+  - name: check
+    image: alpine
+    command: ./check.sh
+`)
+	cfg := newTestConfig(t, repos...)
+	cfg.FailurePolicy = FailFast.String()
+
+	results, err := New(cfg, p, WithRuntime(runtime), WithPlatform(remote)).Run(context.Background())
+	require.Error(t, err)
+	require.Len(t, results, len(repos))
+
+	require.Equal(t, RepoStatusNoOp, results[0].Status)
+	require.Equal(t, RepoStatusFailed, results[1].Status)
+	require.Equal(t, "check", results[1].FailedStep)
+	for _, result := range results[2:] {
+		require.Equal(t, RepoStatusSkipped, result.Status)
+		require.Empty(t, result.Steps)
+	}
+
+	// the repos after the failure never ran
+	require.Len(t, runtime.Calls(), 2)
+}
+
+// newTestConfig returns a config for running the pipeline against the repos without network access.
+func newTestConfig(t *testing.T, repos ...config.Repo) *config.Config {
+	t.Helper()
+
+	return &config.Config{
+		Logger:                   zap.NewNop().Sugar(),
+		DefaultContainerRepoPath: "/repo",
+		Repos:                    repos,
+		TempDir:                  t.TempDir(),
+	}
+}
+
+func TestDryRunRendersPublication(t *testing.T) {
+	t.Parallel()
+
+	remote := containertest.NewRemote(t)
+	remote.AddRepo(t, "backend/es-indexer", map[string]string{".nvmrc": "16\n"})
+	runtime := containertest.NewRuntime().
+		OnCommand("bump", containertest.Response{Files: map[string]string{".nvmrc": "22\n"}})
+
+	// the step doesn't write the output the branch name refers to
+	p := loadTestPipeline(t, `strict: true
+gitlab:
+  branch_name: "node-{{ .Steps.bump.Outputs.version }}"
+steps:
+  - name: bump
+    image: node:22
+    command: ./bump.sh
+`)
+	cfg := newTestConfig(t, config.Repo{Name: "backend/es-indexer"})
+	cfg.DryRun = true
+
+	results, err := New(cfg, p, WithRuntime(runtime), WithPlatform(remote)).Run(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, RepoStatusFailed, results[0].Status)
+	require.ErrorContains(t, results[0].Error, "branch_name")
+}
@@ -0,0 +1,114 @@
+package runner
+
+import (
+	"context"
+	"os"
+
+	"go.uber.org/zap"
+
+	"github.com/brightfame/metamorph/internal/config"
+	"github.com/brightfame/metamorph/internal/fileutil"
+	"github.com/brightfame/metamorph/pkg/git"
+)
+
+// workspace is a working copy of a repository that is shared by every step of a pipeline run.
+type workspace struct {
+	// Repo is the name of the repository, e.g. "backend/es-indexer".
+	Repo string
+	// Dir is the temporary directory the repository was cloned into.
+	Dir string
+	// Path is the root of the cloned repository on the host.
+	Path string
+	// BaseBranch is the branch that was checked out by the clone, usually the default branch.
+	BaseBranch string
+	// Vars are the variables of the manifest merged with the variables of the repo.
+	Vars map[string]string
+	// OutputDir is the directory with the output files of the steps. It is mounted into every step container.
+	OutputDir string
+}
+
+// prepareWorkspace clones the given repository into a new temporary directory. The clone URL and base branch of the
+// repo take precedence over the platform defaults.
+func (r *Runner) prepareWorkspace(ctx context.Context, repo config.Repo, logger *zap.SugaredLogger) (*workspace, error) {
+	repoDestPath, err := os.MkdirTemp(r.cfg.TempDir, "metamorph-")
+	if err != nil {
+		return nil, err
+	}
+
+	auth, err := r.platform.Auth()
+	if err != nil {
+		_ = os.RemoveAll(repoDestPath)
+		return nil, err
+	}
+
+	cloneURL := repo.CloneURL
+	if cloneURL == "" {
+		cloneURL = r.platform.CloneURL(repo.Name)
+	}
+	cloneOpts := git.CloneOptions{
+		URL:         cloneURL,
+		Branch:      repo.BaseBranch,
+		Destination: repoDestPath,
+		Auth:        auth,
+		CABundle:    r.platform.CABundle(),
+	}
+
+	logger.Infof("Cloning repo %s", cloneURL)
+	if err := git.CloneContext(ctx, cloneOpts); err != nil {
+		_ = os.RemoveAll(repoDestPath)
+		return nil, err
+	}
+
+	baseBranch, err := git.CurrentBranch(repoDestPath)
+	if err != nil {
+		_ = os.RemoveAll(repoDestPath)
+		return nil, err
+	}
+
+	// the outputs live outside the clone so they never end up in the diff
+	outputDir, err := os.MkdirTemp(r.cfg.TempDir, "metamorph-outputs-")
+	if err != nil {
+		_ = os.RemoveAll(repoDestPath)
+		return nil, err
+	}
+	if err := os.Chmod(outputDir, 0o777); err != nil {
+		_ = os.RemoveAll(repoDestPath)
+		_ = os.RemoveAll(outputDir)
+		return nil, err
+	}
+
+	return &workspace{
+		Repo:       repo.Name,
+		Dir:        repoDestPath,
+		Path:       fileutil.RepoRootPath(repoDestPath, logger),
+		BaseBranch: baseBranch,
+		Vars:       mergeVars(r.p.Vars, repo.Vars),
+		OutputDir:  outputDir,
+	}, nil
+}
+
+// cleanupWorkspace removes the workspace from disk unless the config asks to keep it.
+func (r *Runner) cleanupWorkspace(ws *workspace, logger *zap.SugaredLogger) {
+	if r.cfg.KeepWorkspace {
+		logger.Infof("Keeping workspace for %s at %s (step outputs in %s)", ws.Repo, ws.Path, ws.OutputDir)
+		return
+	}
+
+	for _, dir := range []string{ws.Dir, ws.OutputDir} {
+		if err := os.RemoveAll(dir); err != nil {
+			logger.Warnf("Unable to remove workspace %s: %v", dir, err)
+		}
+	}
+}
+
+// mergeVars returns the manifest vars overridden by the repo vars.
+func mergeVars(manifest, repo map[string]string) map[string]string {
+	vars := make(map[string]string, len(manifest)+len(repo))
+	for k, v := range manifest {
+		vars[k] = v
+	}
+	for k, v := range repo {
+		vars[k] = v
+	}
+	return vars
+}
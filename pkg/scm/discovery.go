@@ -0,0 +1,60 @@
+package scm
+
+import (
+	"path"
+	"strings"
+
+	"github.com/brightfame/metamorph/internal/config"
+)
+
+// reposPerPage is the page size used when listing repositories.
+const reposPerPage = 100
+
+// Repository is a repository discovered on the SCM platform.
+type Repository struct {
+	// Name is the name of the repository relative to the platform org, e.g. "backend/es-indexer".
+	Name          string   `json:"name"`
+	DefaultBranch string   `json:"default_branch,omitempty"`
+	Visibility    string   `json:"visibility,omitempty"`
+	Archived      bool     `json:"archived"`
+	Topics        []string `json:"topics,omitempty"`
+	Language      string   `json:"language,omitempty"`
+}
+
+// matchesQuery applies the filters of the query that aren't handled by the platform API.
+func matchesQuery(q config.RepoQuery, repo Repository) bool {
+	if repo.Archived != q.IncludeArchived() {
+		return false
+	}
+	if q.Visibility != "" && !strings.EqualFold(q.Visibility, repo.Visibility) {
+		return false
+	}
+	if q.Name != "" {
+		if ok, _ := path.Match(q.Name, repo.Name); !ok {
+			return false
+		}
+	}
+	for _, topic := range q.Topics {
+		if !containsFold(repo.Topics, topic) {
+			return false
+		}
+	}
+	return true
+}
+
+// relativeName strips the org from the full path of a repository.
+func relativeName(org, fullPath string) string {
+	if org == "" {
+		return fullPath
+	}
+	return strings.TrimPrefix(fullPath, strings.TrimSuffix(org, "/")+"/")
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
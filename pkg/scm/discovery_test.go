@@ -0,0 +1,121 @@
+package scm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/brightfame/metamorph/internal/config"
+)
+
+func TestGitLabListRepos(t *testing.T) {
+	t.Parallel()
+
+	// the first page is full so the client has to ask for the second one
+	firstPage := make([]gitlabProject, 0, reposPerPage)
+	for i := 0; i < reposPerPage; i++ {
+		firstPage = append(firstPage, gitlabProject{PathWithNamespace: fmt.Sprintf("backend/services/svc-%03d", i), Visibility: "private"})
+	}
+	firstPage[0].Topics = []string{"node"}
+	secondPage := []gitlabProject{
+		{PathWithNamespace: "backend/services/es-indexer", DefaultBranch: "main", Visibility: "private", Topics: []string{"node", "search"}},
+		{PathWithNamespace: "backend/tools/linter", Visibility: "private", Topics: []string{"node"}},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /groups/{id}/projects", func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/groups/backend%2Fservices/projects", r.URL.EscapedPath())
+		require.Equal(t, "true", r.URL.Query().Get("include_subgroups"))
+		require.Equal(t, "false", r.URL.Query().Get("archived"))
+		require.Equal(t, "node", r.URL.Query().Get("topic"))
+		require.Equal(t, "private", r.URL.Query().Get("visibility"))
+
+		switch r.URL.Query().Get("page") {
+		case "1":
+			writeJSON(t, w, firstPage)
+		case "2":
+			writeJSON(t, w, secondPage)
+		default:
+			writeJSON(t, w, []gitlabProject{})
+		}
+	})
+	mux.HandleFunc("GET /projects/{id}/languages", func(w http.ResponseWriter, r *http.Request) {
+		languages := map[string]float64{"Shell": 10}
+		if r.PathValue("id") == "backend/services/es-indexer" {
+			languages["TypeScript"] = 90
+		}
+		writeJSON(t, w, languages)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	gl := newTestGitLab(t, server.URL)
+	gl.org = ""
+
+	repos, err := gl.ListRepos(context.Background(), config.RepoQuery{
+		Group:            "backend/services",
+		IncludeSubgroups: true,
+		Topics:           []string{"node"},
+		Visibility:       "private",
+		Language:         "typescript",
+		Name:             "backend/services/*",
+	})
+	require.NoError(t, err)
+	require.Equal(t, []Repository{{
+		Name:          "backend/services/es-indexer",
+		DefaultBranch: "main",
+		Visibility:    "private",
+		Topics:        []string{"node", "search"},
+		Language:      "TypeScript",
+	}}, repos)
+}
+
+func TestGitHubListRepos(t *testing.T) {
+	t.Parallel()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /orgs/{org}/repos", func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "brightfame", r.PathValue("org"))
+		require.Equal(t, "1", r.URL.Query().Get("page"))
+		require.Equal(t, strconv.Itoa(reposPerPage), r.URL.Query().Get("per_page"))
+		writeJSON(t, w, []githubRepository{
+			{FullName: "brightfame/metamorph", DefaultBranch: "main", Visibility: "public", Topics: []string{"cli"}, Language: "Go"},
+			{FullName: "brightfame/old-tool", Visibility: "public", Archived: true, Topics: []string{"cli"}, Language: "Go"},
+			{FullName: "brightfame/website", Visibility: "public", Topics: []string{"cli"}, Language: "TypeScript"},
+			{FullName: "brightfame/infra", Visibility: "private", Language: "Go"},
+		})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	gh := newTestGitHub(t, server.URL)
+
+	repos, err := gh.ListRepos(context.Background(), config.RepoQuery{Topics: []string{"cli"}, Language: "go"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"metamorph"}, repoNames(repos))
+
+	archived := true
+	repos, err = gh.ListRepos(context.Background(), config.RepoQuery{Archived: &archived})
+	require.NoError(t, err)
+	require.Equal(t, []string{"old-tool"}, repoNames(repos))
+
+	repos, err = gh.ListRepos(context.Background(), config.RepoQuery{Name: "*a*"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"metamorph", "infra"}, repoNames(repos))
+
+	_, err = gh.ListRepos(context.Background(), config.RepoQuery{Group: "backend"})
+	require.ErrorContains(t, err, "github doesn't support groups")
+}
+
+func repoNames(repos []Repository) []string {
+	names := make([]string, 0, len(repos))
+	for _, repo := range repos {
+		names = append(names, repo.Name)
+	}
+	return names
+}
@@ -0,0 +1,137 @@
+package scm
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+
+	"github.com/brightfame/metamorph/internal/config"
+)
+
+const (
+	cloneProtocolHTTPS = "https"
+	cloneProtocolSSH   = "ssh"
+)
+
+// endpoint contains the resolved URLs and HTTP client used to talk to an SCM platform.
+type endpoint struct {
+	baseURL  string
+	apiURL   string
+	sshHost  string
+	protocol string
+	caBundle []byte
+	client   *http.Client
+}
+
+// newEndpoint resolves the endpoint configuration. When no base URL is configured the given SaaS defaults are used,
+// otherwise the API URL is derived by appending apiPath to the base URL.
+func newEndpoint(cfg config.PlatformEndpointConfig, defaultBaseURL, defaultAPIURL, apiPath string) (endpoint, error) {
+	e := endpoint{
+		baseURL:  strings.TrimSuffix(cfg.BaseURL, "/"),
+		apiURL:   strings.TrimSuffix(cfg.APIURL, "/"),
+		sshHost:  cfg.SSHHost,
+		protocol: cfg.CloneProtocol,
+		client:   http.DefaultClient,
+	}
+
+	if e.baseURL == "" {
+		e.baseURL = defaultBaseURL
+		if e.apiURL == "" {
+			e.apiURL = defaultAPIURL
+		}
+	}
+	if e.apiURL == "" {
+		e.apiURL = e.baseURL + apiPath
+	}
+
+	if e.sshHost == "" {
+		u, err := url.Parse(e.baseURL)
+		if err != nil {
+			return e, fmt.Errorf("invalid platform base URL %q: %w", e.baseURL, err)
+		}
+		e.sshHost = u.Hostname()
+	}
+
+	switch e.protocol {
+	case "":
+		e.protocol = cloneProtocolHTTPS
+	case cloneProtocolHTTPS, cloneProtocolSSH:
+	default:
+		return e, fmt.Errorf("unknown clone protocol: %s", e.protocol)
+	}
+
+	caBundle, err := cfg.LoadCABundle()
+	if err != nil {
+		return e, err
+	}
+	if caBundle != nil {
+		client, err := newHTTPClient(caBundle)
+		if err != nil {
+			return e, err
+		}
+		e.caBundle = caBundle
+		e.client = client
+	}
+
+	return e, nil
+}
+
+// cloneURL returns the clone URL of the repository with the given full path, e.g. "myorg/backend/es-indexer".
+func (e *endpoint) cloneURL(fullPath string) string {
+	if e.protocol == cloneProtocolSSH {
+		// scp-like syntax doesn't support ports, so fall back to a ssh:// URL when one is given
+		if strings.Contains(e.sshHost, ":") {
+			return fmt.Sprintf("ssh://git@%s/%s.git", e.sshHost, fullPath)
+		}
+		return fmt.Sprintf("git@%s:%s.git", e.sshHost, fullPath)
+	}
+	return fmt.Sprintf("%s/%s.git", e.baseURL, fullPath)
+}
+
+// gitAuth returns the credentials for git operations. SSH clones use the SSH agent, HTTPS clones use basic auth with
+// the token as the password.
+func (e *endpoint) gitAuth(auth config.PlatformAuthConfig, defaultUsername string) (transport.AuthMethod, error) {
+	if e.protocol == cloneProtocolSSH {
+		return ssh.NewSSHAgentAuth("git")
+	}
+
+	username := auth.Username
+	if username == "" {
+		username = defaultUsername
+	}
+	return &githttp.BasicAuth{
+		Username: username,
+		Password: auth.Password,
+	}, nil
+}
+
+// CABundle returns the additional CA certificates used to verify the platform, if any.
+func (e *endpoint) CABundle() []byte {
+	return e.caBundle
+}
+
+// newHTTPClient returns an HTTP client that trusts the system certificates plus the given PEM encoded CA bundle.
+func newHTTPClient(caBundle []byte) (*http.Client, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(caBundle) {
+		return nil, fmt.Errorf("CA bundle does not contain any valid PEM certificates")
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{
+		RootCAs:    pool,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	return &http.Client{Transport: transport}, nil
+}
@@ -0,0 +1,146 @@
+package scm
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/brightfame/metamorph/internal/config"
+)
+
+func TestPlatformEndpoints(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name             string
+		platform         PlatformType
+		endpoint         config.PlatformEndpointConfig
+		expectedAPIURL   string
+		expectedCloneURL string
+	}{
+		{
+			"gitlab.com",
+			GitLabPlatformType,
+			config.PlatformEndpointConfig{},
+			"https://gitlab.com/api/v4",
+			"https://gitlab.com/backend/es-indexer.git",
+		},
+		{
+			"Self-hosted GitLab",
+			GitLabPlatformType,
+			config.PlatformEndpointConfig{BaseURL: "https://git.ourcompany.internal/"},
+			"https://git.ourcompany.internal/api/v4",
+			"https://git.ourcompany.internal/backend/es-indexer.git",
+		},
+		{
+			"Self-hosted GitLab over SSH",
+			GitLabPlatformType,
+			config.PlatformEndpointConfig{BaseURL: "https://git.ourcompany.internal", CloneProtocol: "ssh"},
+			"https://git.ourcompany.internal/api/v4",
+			"git@git.ourcompany.internal:backend/es-indexer.git",
+		},
+		{
+			"Self-hosted GitLab with SSH port",
+			GitLabPlatformType,
+			config.PlatformEndpointConfig{BaseURL: "https://git.ourcompany.internal", SSHHost: "ssh.ourcompany.internal:2222", CloneProtocol: "ssh"},
+			"https://git.ourcompany.internal/api/v4",
+			"ssh://git@ssh.ourcompany.internal:2222/backend/es-indexer.git",
+		},
+		{
+			"github.com",
+			GitHubPlatformType,
+			config.PlatformEndpointConfig{},
+			"https://api.github.com",
+			"https://github.com/backend/es-indexer.git",
+		},
+		{
+			"GitHub Enterprise",
+			GitHubPlatformType,
+			config.PlatformEndpointConfig{BaseURL: "https://github.ourcompany.internal"},
+			"https://github.ourcompany.internal/api/v3",
+			"https://github.ourcompany.internal/backend/es-indexer.git",
+		},
+		{
+			"GitHub Enterprise with explicit API URL",
+			GitHubPlatformType,
+			config.PlatformEndpointConfig{BaseURL: "https://github.ourcompany.internal", APIURL: "https://api.github.ourcompany.internal"},
+			"https://api.github.ourcompany.internal",
+			"https://github.ourcompany.internal/backend/es-indexer.git",
+		},
+	}
+
+	for _, testCase := range testCases {
+		// The following is necessary to make sure testCase's values don't
+		// get updated due to concurrency within the scope of t.Run(..) below
+		testCase := testCase
+
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := &config.Config{
+				PlatformOrg: "backend",
+				Platforms:   map[string]config.PlatformEndpointConfig{testCase.platform.String(): testCase.endpoint},
+			}
+			platform, err := NewPlatform(testCase.platform, cfg)
+			require.NoError(t, err)
+			require.Equal(t, testCase.expectedCloneURL, platform.CloneURL("es-indexer"))
+
+			switch p := platform.(type) {
+			case *GitLab:
+				require.Equal(t, testCase.expectedAPIURL, p.apiURL)
+			case *GitHub:
+				require.Equal(t, testCase.expectedAPIURL, p.apiURL)
+			}
+		})
+	}
+}
+
+func TestPlatformInvalidCloneProtocol(t *testing.T) {
+	t.Parallel()
+
+	cfg := &config.Config{
+		Platforms: map[string]config.PlatformEndpointConfig{"gitlab": {CloneProtocol: "ftp"}},
+	}
+	_, err := NewGitLab(cfg)
+	require.ErrorContains(t, err, "unknown clone protocol: ftp")
+}
+
+func TestPlatformCABundle(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewTLSServer((&fakeGitLab{}).handler(t))
+	defer server.Close()
+
+	caPath := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	require.NoError(t, os.WriteFile(caPath, caPEM, 0o600))
+
+	endpoint := config.PlatformEndpointConfig{BaseURL: server.URL}
+
+	// without the CA bundle the self-signed certificate is rejected
+	untrusted, err := NewGitLab(&config.Config{
+		PlatformOrg: "backend",
+		Platforms:   map[string]config.PlatformEndpointConfig{"gitlab": endpoint},
+	})
+	require.NoError(t, err)
+	untrusted.apiURL = server.URL
+	_, err = untrusted.GetChangeRequest(context.Background(), "es-indexer", 7)
+	require.Error(t, err)
+
+	endpoint.CABundle = caPath
+	trusted, err := NewGitLab(&config.Config{
+		PlatformOrg: "backend",
+		Platforms:   map[string]config.PlatformEndpointConfig{"gitlab": endpoint},
+	})
+	require.NoError(t, err)
+	require.Equal(t, caPEM, trusted.CABundle())
+	trusted.apiURL = server.URL
+	mr, err := trusted.GetChangeRequest(context.Background(), "es-indexer", 7)
+	require.NoError(t, err)
+	require.Equal(t, 7, mr.Number)
+}
@@ -0,0 +1,287 @@
+package scm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+
+	"github.com/brightfame/metamorph/internal/config"
+)
+
+const (
+	// DefaultGitHubURL is the URL of github.com.
+	DefaultGitHubURL = "https://github.com"
+	// DefaultGitHubAPIURL is the API URL of github.com.
+	DefaultGitHubAPIURL = "https://api.github.com"
+)
+
+// GitHub implements the Platform interface using the GitHub REST API.
+type GitHub struct {
+	endpoint
+	org  string
+	auth config.PlatformAuthConfig
+}
+
+// githubPullRequest is a GitHub pull request as returned by the API.
+type githubPullRequest struct {
+	Number  int    `json:"number"`
+	State   string `json:"state"`
+	Merged  bool   `json:"merged"`
+	HTMLURL string `json:"html_url"`
+}
+
+// githubRepository is a GitHub repository as returned by the API.
+type githubRepository struct {
+	FullName      string   `json:"full_name"`
+	DefaultBranch string   `json:"default_branch"`
+	Visibility    string   `json:"visibility"`
+	Archived      bool     `json:"archived"`
+	Topics        []string `json:"topics"`
+	Language      string   `json:"language"`
+}
+
+type githubPullRequestPayload struct {
+	Title string `json:"title,omitempty"`
+	Body  string `json:"body,omitempty"`
+	Head  string `json:"head,omitempty"`
+	Base  string `json:"base,omitempty"`
+	State string `json:"state,omitempty"`
+}
+
+// NewGitHub creates a new GitHub platform instance. The endpoint defaults to github.com unless a self-hosted
+// base URL is configured for the platform.
+func NewGitHub(cfg *config.Config) (*GitHub, error) {
+	e, err := newEndpoint(cfg.Platforms[GitHubPlatformType.String()], DefaultGitHubURL, DefaultGitHubAPIURL, "/api/v3")
+	if err != nil {
+		return nil, err
+	}
+
+	return &GitHub{
+		endpoint: e,
+		org:      cfg.PlatformOrg,
+		auth:     cfg.PlatformAuthConfig,
+	}, nil
+}
+
+// Type returns the GitHub platform type.
+func (g *GitHub) Type() PlatformType {
+	return GitHubPlatformType
+}
+
+// CloneURL returns the HTTPS or SSH clone URL of the given repository.
+func (g *GitHub) CloneURL(repo string) string {
+	return g.cloneURL(g.fullName(repo))
+}
+
+// Auth returns the git credentials. GitHub accepts any username when a token is used as the password.
+func (g *GitHub) Auth() (transport.AuthMethod, error) {
+	return g.gitAuth(g.auth, "x-access-token")
+}
+
+// CreateOrUpdateChangeRequest opens a pull request for the source branch, or updates the open pull request if one
+// already exists. Labels, assignees and reviewers are applied after the pull request is created.
+func (g *GitHub) CreateOrUpdateChangeRequest(ctx context.Context, opts ChangeRequestOptions) (*ChangeRequest, error) {
+	repo := g.fullName(opts.Repo)
+	existing, err := g.findOpenPullRequest(ctx, repo, opts.SourceBranch)
+	if err != nil {
+		return nil, err
+	}
+
+	pr := &githubPullRequest{}
+	if existing != nil {
+		payload := githubPullRequestPayload{Title: opts.Title, Body: opts.Description}
+		err = g.do(ctx, http.MethodPatch, fmt.Sprintf("/repos/%s/pulls/%d", repo, existing.Number), payload, pr)
+	} else {
+		payload := githubPullRequestPayload{
+			Title: opts.Title,
+			Body:  opts.Description,
+			Head:  opts.SourceBranch,
+			Base:  opts.TargetBranch,
+		}
+		err = g.do(ctx, http.MethodPost, fmt.Sprintf("/repos/%s/pulls", repo), payload, pr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(opts.Labels) > 0 {
+		path := fmt.Sprintf("/repos/%s/issues/%d/labels", repo, pr.Number)
+		if err := g.do(ctx, http.MethodPost, path, map[string][]string{"labels": opts.Labels}, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(opts.Assignees) > 0 {
+		path := fmt.Sprintf("/repos/%s/issues/%d/assignees", repo, pr.Number)
+		if err := g.do(ctx, http.MethodPost, path, map[string][]string{"assignees": opts.Assignees}, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(opts.Reviewers) > 0 {
+		path := fmt.Sprintf("/repos/%s/pulls/%d/requested_reviewers", repo, pr.Number)
+		if err := g.do(ctx, http.MethodPost, path, map[string][]string{"reviewers": opts.Reviewers}, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return pr.changeRequest(), nil
+}
+
+// CloseChangeRequest closes the pull request without merging it.
+func (g *GitHub) CloseChangeRequest(ctx context.Context, repo string, number int) error {
+	path := fmt.Sprintf("/repos/%s/pulls/%d", g.fullName(repo), number)
+	return g.do(ctx, http.MethodPatch, path, githubPullRequestPayload{State: "closed"}, nil)
+}
+
+// GetChangeRequest fetches the current status of the pull request.
+func (g *GitHub) GetChangeRequest(ctx context.Context, repo string, number int) (*ChangeRequest, error) {
+	pr := &githubPullRequest{}
+	if err := g.do(ctx, http.MethodGet, fmt.Sprintf("/repos/%s/pulls/%d", g.fullName(repo), number), nil, pr); err != nil {
+		return nil, err
+	}
+	return pr.changeRequest(), nil
+}
+
+// ListRepos returns the repositories of the org that match the query. The org repository API doesn't support
+// filtering, so every filter is applied to the listed repositories.
+func (g *GitHub) ListRepos(ctx context.Context, query config.RepoQuery) ([]Repository, error) {
+	if query.Group != "" || query.IncludeSubgroups {
+		return nil, fmt.Errorf("github doesn't support groups, remove group and include_subgroups from the query")
+	}
+	if g.org == "" {
+		return nil, fmt.Errorf("a platform org is required to list github repositories")
+	}
+
+	params := url.Values{}
+	params.Set("type", "all")
+	params.Set("sort", "full_name")
+	params.Set("per_page", fmt.Sprintf("%d", reposPerPage))
+
+	repos := make([]Repository, 0)
+	for page := 1; ; page++ {
+		params.Set("page", fmt.Sprintf("%d", page))
+
+		var ghRepos []githubRepository
+		path := fmt.Sprintf("/orgs/%s/repos?%s", url.PathEscape(g.org), params.Encode())
+		if err := g.do(ctx, http.MethodGet, path, nil, &ghRepos); err != nil {
+			return nil, err
+		}
+
+		for _, ghRepo := range ghRepos {
+			repo := Repository{
+				Name:          relativeName(g.org, ghRepo.FullName),
+				DefaultBranch: ghRepo.DefaultBranch,
+				Visibility:    ghRepo.Visibility,
+				Archived:      ghRepo.Archived,
+				Topics:        ghRepo.Topics,
+				Language:      ghRepo.Language,
+			}
+			if !matchesQuery(query, repo) {
+				continue
+			}
+			if query.Language != "" && !strings.EqualFold(query.Language, repo.Language) {
+				continue
+			}
+			repos = append(repos, repo)
+		}
+
+		if len(ghRepos) < reposPerPage {
+			break
+		}
+	}
+
+	return repos, nil
+}
+
+// fullName returns the owner/name of the repository, e.g. "brightfame/metamorph".
+func (g *GitHub) fullName(repo string) string {
+	return path.Join(g.org, repo)
+}
+
+// findOpenPullRequest returns the open pull request for the head branch, or nil if there isn't one.
+func (g *GitHub) findOpenPullRequest(ctx context.Context, repo, head string) (*githubPullRequest, error) {
+	owner, _, _ := strings.Cut(repo, "/")
+
+	query := url.Values{}
+	query.Set("head", owner+":"+head)
+	query.Set("state", "open")
+
+	var prs []githubPullRequest
+	if err := g.do(ctx, http.MethodGet, fmt.Sprintf("/repos/%s/pulls?%s", repo, query.Encode()), nil, &prs); err != nil {
+		return nil, err
+	}
+
+	if len(prs) == 0 {
+		return nil, nil
+	}
+	return &prs[0], nil
+}
+
+// do sends a request to the GitHub API and decodes the JSON response into out.
+func (g *GitHub) do(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, g.apiURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if g.auth.Password != "" {
+		req.Header.Set("Authorization", "Bearer "+g.auth.Password)
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("github api request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("github api %s %s returned %d: %s", method, path, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("unable to decode github api response: %w", err)
+	}
+	return nil
+}
+
+// changeRequest converts the pull request into a platform-agnostic ChangeRequest.
+func (pr *githubPullRequest) changeRequest() *ChangeRequest {
+	state := ChangeRequestOpen
+	if pr.Merged {
+		state = ChangeRequestMerged
+	} else if pr.State == "closed" {
+		state = ChangeRequestClosed
+	}
+
+	return &ChangeRequest{
+		Number: pr.Number,
+		URL:    pr.HTMLURL,
+		State:  state,
+	}
+}
@@ -0,0 +1,151 @@
+package scm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/brightfame/metamorph/internal/config"
+)
+
+// fakeGitHub is a minimal stand-in for the GitHub pull request API.
+type fakeGitHub struct {
+	existing  []githubPullRequest
+	created   []githubPullRequestPayload
+	updated   []githubPullRequestPayload
+	labels    []string
+	assignees []string
+	reviewers []string
+}
+
+func (f *fakeGitHub) handler(t *testing.T) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /repos/brightfame/metamorph/pulls", func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		require.Equal(t, "brightfame:node-v22", r.URL.Query().Get("head"))
+		writeJSON(t, w, f.existing)
+	})
+	mux.HandleFunc("POST /repos/brightfame/metamorph/pulls", func(w http.ResponseWriter, r *http.Request) {
+		var payload githubPullRequestPayload
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		f.created = append(f.created, payload)
+		w.WriteHeader(http.StatusCreated)
+		writeJSON(t, w, githubPullRequest{Number: 12, State: "open", HTMLURL: "https://github.com/brightfame/metamorph/pull/12"})
+	})
+	mux.HandleFunc("PATCH /repos/brightfame/metamorph/pulls/{number}", func(w http.ResponseWriter, r *http.Request) {
+		var payload githubPullRequestPayload
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		f.updated = append(f.updated, payload)
+		state := "open"
+		if payload.State != "" {
+			state = payload.State
+		}
+		writeJSON(t, w, githubPullRequest{Number: 3, State: state, HTMLURL: "https://github.com/brightfame/metamorph/pull/3"})
+	})
+	mux.HandleFunc("GET /repos/brightfame/metamorph/pulls/{number}", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(t, w, githubPullRequest{Number: 3, State: "closed", Merged: true, HTMLURL: "https://github.com/brightfame/metamorph/pull/3"})
+	})
+	mux.HandleFunc("POST /repos/brightfame/metamorph/issues/{number}/labels", func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string][]string
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		f.labels = append(f.labels, payload["labels"]...)
+		writeJSON(t, w, []any{})
+	})
+	mux.HandleFunc("POST /repos/brightfame/metamorph/issues/{number}/assignees", func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string][]string
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		f.assignees = append(f.assignees, payload["assignees"]...)
+		writeJSON(t, w, map[string]any{})
+	})
+	mux.HandleFunc("POST /repos/brightfame/metamorph/pulls/{number}/requested_reviewers", func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string][]string
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		f.reviewers = append(f.reviewers, payload["reviewers"]...)
+		writeJSON(t, w, map[string]any{})
+	})
+	return mux
+}
+
+// newTestGitHub returns a GitHub platform for the "brightfame" org that talks to the given API server.
+func newTestGitHub(t *testing.T, apiURL string) *GitHub {
+	gh, err := NewGitHub(&config.Config{
+		PlatformOrg:        "brightfame",
+		PlatformAuthConfig: config.PlatformAuthConfig{Password: "secret"},
+	})
+	require.NoError(t, err)
+	gh.apiURL = apiURL
+	return gh
+}
+
+func TestGitHubCreatePullRequest(t *testing.T) {
+	t.Parallel()
+
+	fake := &fakeGitHub{}
+	server := httptest.NewServer(fake.handler(t))
+	defer server.Close()
+
+	gh := newTestGitHub(t, server.URL)
+	pr, err := gh.CreateOrUpdateChangeRequest(context.Background(), ChangeRequestOptions{
+		Repo:         "metamorph",
+		SourceBranch: "node-v22",
+		TargetBranch: "main",
+		Title:        "Upgrade node to v22",
+		Description:  "This PR upgrades node to v22.",
+		Labels:       []string{"automated-pr"},
+		Assignees:    []string{"robmorgan"},
+		Reviewers:    []string{"reviewer"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, 12, pr.Number)
+	require.Equal(t, "https://github.com/brightfame/metamorph/pull/12", pr.URL)
+
+	require.Equal(t, []githubPullRequestPayload{{
+		Title: "Upgrade node to v22",
+		Body:  "This PR upgrades node to v22.",
+		Head:  "node-v22",
+		Base:  "main",
+	}}, fake.created)
+	require.Empty(t, fake.updated)
+	require.Equal(t, []string{"automated-pr"}, fake.labels)
+	require.Equal(t, []string{"robmorgan"}, fake.assignees)
+	require.Equal(t, []string{"reviewer"}, fake.reviewers)
+}
+
+func TestGitHubUpdateExistingPullRequest(t *testing.T) {
+	t.Parallel()
+
+	fake := &fakeGitHub{existing: []githubPullRequest{{Number: 3, State: "open"}}}
+	server := httptest.NewServer(fake.handler(t))
+	defer server.Close()
+
+	gh := newTestGitHub(t, server.URL)
+	pr, err := gh.CreateOrUpdateChangeRequest(context.Background(), ChangeRequestOptions{
+		Repo:         "metamorph",
+		SourceBranch: "node-v22",
+		Title:        "Upgrade node to v22 (again)",
+	})
+	require.NoError(t, err)
+	require.Equal(t, 3, pr.Number)
+	require.Empty(t, fake.created)
+	require.Equal(t, []githubPullRequestPayload{{Title: "Upgrade node to v22 (again)"}}, fake.updated)
+}
+
+func TestGitHubCloseAndGetPullRequest(t *testing.T) {
+	t.Parallel()
+
+	fake := &fakeGitHub{}
+	server := httptest.NewServer(fake.handler(t))
+	defer server.Close()
+
+	gh := newTestGitHub(t, server.URL)
+	require.NoError(t, gh.CloseChangeRequest(context.Background(), "metamorph", 3))
+	require.Equal(t, []githubPullRequestPayload{{State: "closed"}}, fake.updated)
+
+	pr, err := gh.GetChangeRequest(context.Background(), "metamorph", 3)
+	require.NoError(t, err)
+	require.Equal(t, ChangeRequestMerged, pr.State)
+}
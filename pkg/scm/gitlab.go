@@ -0,0 +1,338 @@
+package scm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+
+	"github.com/brightfame/metamorph/internal/config"
+)
+
+const (
+	// DefaultGitLabURL is the URL of gitlab.com.
+	DefaultGitLabURL = "https://gitlab.com"
+	// DefaultGitLabAPIURL is the API URL of gitlab.com.
+	DefaultGitLabAPIURL = "https://gitlab.com/api/v4"
+)
+
+// GitLab implements the Platform interface using the GitLab REST API.
+type GitLab struct {
+	endpoint
+	org  string
+	auth config.PlatformAuthConfig
+}
+
+// gitlabMergeRequest is a GitLab merge request as returned by the API.
+type gitlabMergeRequest struct {
+	ID     int    `json:"id"`
+	IID    int    `json:"iid"`
+	State  string `json:"state"`
+	WebURL string `json:"web_url"`
+}
+
+type gitlabUser struct {
+	ID       int    `json:"id"`
+	Username string `json:"username"`
+}
+
+// gitlabProject is a GitLab project as returned by the API.
+type gitlabProject struct {
+	PathWithNamespace string   `json:"path_with_namespace"`
+	DefaultBranch     string   `json:"default_branch"`
+	Visibility        string   `json:"visibility"`
+	Archived          bool     `json:"archived"`
+	Topics            []string `json:"topics"`
+}
+
+// gitlabMergeRequestPayload creates or updates a merge request. Labels, assignees and reviewers are left out when the
+// manifest sets none, so that updating a merge request keeps the ones people added by hand.
+type gitlabMergeRequestPayload struct {
+	SourceBranch string `json:"source_branch,omitempty"`
+	TargetBranch string `json:"target_branch,omitempty"`
+	Title        string `json:"title"`
+	Description  string `json:"description"`
+	Labels       string `json:"labels,omitempty"`
+	AssigneeIDs  []int  `json:"assignee_ids,omitempty"`
+	ReviewerIDs  []int  `json:"reviewer_ids,omitempty"`
+}
+
+// NewGitLab creates a new GitLab platform instance. The endpoint defaults to gitlab.com unless a self-hosted
+// base URL is configured for the platform.
+func NewGitLab(cfg *config.Config) (*GitLab, error) {
+	e, err := newEndpoint(cfg.Platforms[GitLabPlatformType.String()], DefaultGitLabURL, DefaultGitLabAPIURL, "/api/v4")
+	if err != nil {
+		return nil, err
+	}
+
+	return &GitLab{
+		endpoint: e,
+		org:      cfg.PlatformOrg,
+		auth:     cfg.PlatformAuthConfig,
+	}, nil
+}
+
+// Type returns the GitLab platform type.
+func (g *GitLab) Type() PlatformType {
+	return GitLabPlatformType
+}
+
+// CloneURL returns the HTTPS or SSH clone URL of the given repository.
+func (g *GitLab) CloneURL(repo string) string {
+	return g.cloneURL(g.fullPath(repo))
+}
+
+// Auth returns the git credentials. GitLab accepts any username when a token is used as the password.
+func (g *GitLab) Auth() (transport.AuthMethod, error) {
+	return g.gitAuth(g.auth, "oauth2")
+}
+
+// CreateOrUpdateChangeRequest opens a merge request for the source branch, or updates the open merge request if one
+// already exists. Assignees and reviewers are resolved from usernames to user IDs.
+func (g *GitLab) CreateOrUpdateChangeRequest(ctx context.Context, opts ChangeRequestOptions) (*ChangeRequest, error) {
+	assigneeIDs, err := g.resolveUserIDs(ctx, opts.Assignees)
+	if err != nil {
+		return nil, err
+	}
+
+	reviewerIDs, err := g.resolveUserIDs(ctx, opts.Reviewers)
+	if err != nil {
+		return nil, err
+	}
+
+	payload := gitlabMergeRequestPayload{
+		Title:       opts.Title,
+		Description: opts.Description,
+		Labels:      strings.Join(opts.Labels, ","),
+		AssigneeIDs: assigneeIDs,
+		ReviewerIDs: reviewerIDs,
+	}
+
+	project := g.fullPath(opts.Repo)
+	existing, err := g.findOpenMergeRequest(ctx, project, opts.SourceBranch)
+	if err != nil {
+		return nil, err
+	}
+
+	mr := &gitlabMergeRequest{}
+	if existing != nil {
+		path := fmt.Sprintf("/projects/%s/merge_requests/%d", projectID(project), existing.IID)
+		err = g.do(ctx, http.MethodPut, path, payload, mr)
+	} else {
+		payload.SourceBranch = opts.SourceBranch
+		payload.TargetBranch = opts.TargetBranch
+		path := fmt.Sprintf("/projects/%s/merge_requests", projectID(project))
+		err = g.do(ctx, http.MethodPost, path, payload, mr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return mr.changeRequest(), nil
+}
+
+// CloseChangeRequest closes the merge request without merging it.
+func (g *GitLab) CloseChangeRequest(ctx context.Context, repo string, number int) error {
+	path := fmt.Sprintf("/projects/%s/merge_requests/%d", projectID(g.fullPath(repo)), number)
+	return g.do(ctx, http.MethodPut, path, map[string]string{"state_event": "close"}, nil)
+}
+
+// GetChangeRequest fetches the current status of the merge request.
+func (g *GitLab) GetChangeRequest(ctx context.Context, repo string, number int) (*ChangeRequest, error) {
+	mr := &gitlabMergeRequest{}
+	path := fmt.Sprintf("/projects/%s/merge_requests/%d", projectID(g.fullPath(repo)), number)
+	if err := g.do(ctx, http.MethodGet, path, nil, mr); err != nil {
+		return nil, err
+	}
+	return mr.changeRequest(), nil
+}
+
+// ListRepos returns the projects of the group that match the query. Archived state, visibility and topics are
+// filtered by the API, languages are looked up per project since the project list doesn't include them.
+func (g *GitLab) ListRepos(ctx context.Context, query config.RepoQuery) ([]Repository, error) {
+	group := g.fullPath(query.Group)
+	if group == "" {
+		return nil, fmt.Errorf("a platform org or group is required to list gitlab projects")
+	}
+
+	params := url.Values{}
+	params.Set("include_subgroups", fmt.Sprintf("%t", query.IncludeSubgroups))
+	params.Set("archived", fmt.Sprintf("%t", query.IncludeArchived()))
+	params.Set("order_by", "path")
+	params.Set("sort", "asc")
+	params.Set("per_page", fmt.Sprintf("%d", reposPerPage))
+	if query.Visibility != "" {
+		params.Set("visibility", query.Visibility)
+	}
+	if len(query.Topics) > 0 {
+		params.Set("topic", strings.Join(query.Topics, ","))
+	}
+
+	repos := make([]Repository, 0)
+	for page := 1; ; page++ {
+		params.Set("page", fmt.Sprintf("%d", page))
+
+		var projects []gitlabProject
+		path := fmt.Sprintf("/groups/%s/projects?%s", projectID(group), params.Encode())
+		if err := g.do(ctx, http.MethodGet, path, nil, &projects); err != nil {
+			return nil, err
+		}
+
+		for _, project := range projects {
+			repo := Repository{
+				Name:          relativeName(g.org, project.PathWithNamespace),
+				DefaultBranch: project.DefaultBranch,
+				Visibility:    project.Visibility,
+				Archived:      project.Archived,
+				Topics:        project.Topics,
+			}
+			if !matchesQuery(query, repo) {
+				continue
+			}
+
+			if query.Language != "" {
+				language, err := g.findLanguage(ctx, project.PathWithNamespace, query.Language)
+				if err != nil {
+					return nil, err
+				}
+				if language == "" {
+					continue
+				}
+				repo.Language = language
+			}
+
+			repos = append(repos, repo)
+		}
+
+		if len(projects) < reposPerPage {
+			break
+		}
+	}
+
+	return repos, nil
+}
+
+// findLanguage returns the name of the language as reported by GitLab if the project uses it, or an empty string.
+func (g *GitLab) findLanguage(ctx context.Context, project, language string) (string, error) {
+	languages := map[string]float64{}
+	path := fmt.Sprintf("/projects/%s/languages", projectID(project))
+	if err := g.do(ctx, http.MethodGet, path, nil, &languages); err != nil {
+		return "", err
+	}
+
+	for name := range languages {
+		if strings.EqualFold(name, language) {
+			return name, nil
+		}
+	}
+	return "", nil
+}
+
+// fullPath returns the path of the repository including the org, e.g. "myorg/backend/es-indexer".
+func (g *GitLab) fullPath(repo string) string {
+	return path.Join(g.org, repo)
+}
+
+// findOpenMergeRequest returns the open merge request for the source branch, or nil if there isn't one.
+func (g *GitLab) findOpenMergeRequest(ctx context.Context, project, sourceBranch string) (*gitlabMergeRequest, error) {
+	query := url.Values{}
+	query.Set("source_branch", sourceBranch)
+	query.Set("state", "opened")
+
+	var mrs []gitlabMergeRequest
+	path := fmt.Sprintf("/projects/%s/merge_requests?%s", projectID(project), query.Encode())
+	if err := g.do(ctx, http.MethodGet, path, nil, &mrs); err != nil {
+		return nil, err
+	}
+
+	if len(mrs) == 0 {
+		return nil, nil
+	}
+	return &mrs[0], nil
+}
+
+// resolveUserIDs looks up the user ID for each of the given usernames.
+func (g *GitLab) resolveUserIDs(ctx context.Context, usernames []string) ([]int, error) {
+	ids := make([]int, 0, len(usernames))
+	for _, username := range usernames {
+		var users []gitlabUser
+		path := "/users?username=" + url.QueryEscape(username)
+		if err := g.do(ctx, http.MethodGet, path, nil, &users); err != nil {
+			return nil, err
+		}
+		if len(users) == 0 {
+			return nil, fmt.Errorf("gitlab user %q not found", username)
+		}
+		ids = append(ids, users[0].ID)
+	}
+	return ids, nil
+}
+
+// do sends a request to the GitLab API and decodes the JSON response into out.
+func (g *GitLab) do(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, g.apiURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("PRIVATE-TOKEN", g.auth.Password)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("gitlab api request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("gitlab api %s %s returned %d: %s", method, path, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("unable to decode gitlab api response: %w", err)
+	}
+	return nil
+}
+
+// changeRequest converts the merge request into a platform-agnostic ChangeRequest.
+func (mr *gitlabMergeRequest) changeRequest() *ChangeRequest {
+	state := ChangeRequestOpen
+	switch mr.State {
+	case "merged":
+		state = ChangeRequestMerged
+	case "closed":
+		state = ChangeRequestClosed
+	}
+
+	return &ChangeRequest{
+		Number: mr.IID,
+		URL:    mr.WebURL,
+		State:  state,
+	}
+}
+
+// projectID returns the URL-encoded project path used to identify a project in the GitLab API.
+func projectID(project string) string {
+	return url.PathEscape(project)
+}
@@ -0,0 +1,179 @@
+package scm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/brightfame/metamorph/internal/config"
+)
+
+// fakeGitLab is a minimal stand-in for the GitLab merge request API.
+type fakeGitLab struct {
+	users    map[string]int
+	existing []gitlabMergeRequest
+	created  []gitlabMergeRequestPayload
+	updated  []gitlabMergeRequestPayload
+	// updatedFields are the fields sent by each update.
+	updatedFields [][]string
+}
+
+func (f *fakeGitLab) handler(t *testing.T) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /users", func(w http.ResponseWriter, r *http.Request) {
+		users := []gitlabUser{}
+		if id, ok := f.users[r.URL.Query().Get("username")]; ok {
+			users = append(users, gitlabUser{ID: id, Username: r.URL.Query().Get("username")})
+		}
+		writeJSON(t, w, users)
+	})
+	mux.HandleFunc("GET /projects/{id}/merge_requests", func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/projects/backend%2Fes-indexer/merge_requests", r.URL.EscapedPath())
+		require.Equal(t, "node-v22", r.URL.Query().Get("source_branch"))
+		require.Equal(t, "opened", r.URL.Query().Get("state"))
+		writeJSON(t, w, f.existing)
+	})
+	mux.HandleFunc("POST /projects/{id}/merge_requests", func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "secret", r.Header.Get("PRIVATE-TOKEN"))
+		var payload gitlabMergeRequestPayload
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		f.created = append(f.created, payload)
+		w.WriteHeader(http.StatusCreated)
+		writeJSON(t, w, gitlabMergeRequest{ID: 100, IID: 1, State: "opened", WebURL: "https://gitlab.example.com/backend/es-indexer/-/merge_requests/1"})
+	})
+	mux.HandleFunc("PUT /projects/{id}/merge_requests/{iid}", func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "7", r.PathValue("iid"))
+		var body json.RawMessage
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		var payload gitlabMergeRequestPayload
+		require.NoError(t, json.Unmarshal(body, &payload))
+		f.updated = append(f.updated, payload)
+		var fields map[string]any
+		require.NoError(t, json.Unmarshal(body, &fields))
+		names := make([]string, 0, len(fields))
+		for name := range fields {
+			names = append(names, name)
+		}
+		f.updatedFields = append(f.updatedFields, names)
+		writeJSON(t, w, gitlabMergeRequest{ID: 107, IID: 7, State: "opened", WebURL: "https://gitlab.example.com/backend/es-indexer/-/merge_requests/7"})
+	})
+	mux.HandleFunc("GET /projects/{id}/merge_requests/{iid}", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(t, w, gitlabMergeRequest{ID: 107, IID: 7, State: "merged", WebURL: "https://gitlab.example.com/backend/es-indexer/-/merge_requests/7"})
+	})
+	return mux
+}
+
+// newTestGitLab returns a GitLab platform for the "backend" org that talks to the given API server.
+func newTestGitLab(t *testing.T, apiURL string) *GitLab {
+	gl, err := NewGitLab(&config.Config{
+		PlatformOrg:        "backend",
+		PlatformAuthConfig: config.PlatformAuthConfig{Password: "secret"},
+	})
+	require.NoError(t, err)
+	gl.apiURL = apiURL
+	return gl
+}
+
+func writeJSON(t *testing.T, w http.ResponseWriter, v any) {
+	t.Helper()
+	require.NoError(t, json.NewEncoder(w).Encode(v))
+}
+
+func TestGitLabCreateMergeRequest(t *testing.T) {
+	t.Parallel()
+
+	fake := &fakeGitLab{users: map[string]int{"robmorgan": 42, "reviewer": 43}}
+	server := httptest.NewServer(fake.handler(t))
+	defer server.Close()
+
+	gl := newTestGitLab(t, server.URL)
+	mr, err := gl.CreateOrUpdateChangeRequest(context.Background(), ChangeRequestOptions{
+		Repo:         "es-indexer",
+		SourceBranch: "node-v22",
+		TargetBranch: "main",
+		Title:        "Upgrade node to v22",
+		Description:  "This MR upgrades node to v22.",
+		Labels:       []string{"automated-pr", "dependency"},
+		Assignees:    []string{"robmorgan"},
+		Reviewers:    []string{"reviewer"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, mr.Number)
+	require.Equal(t, ChangeRequestOpen, mr.State)
+	require.Equal(t, "https://gitlab.example.com/backend/es-indexer/-/merge_requests/1", mr.URL)
+
+	require.Len(t, fake.created, 1)
+	require.Empty(t, fake.updated)
+	created := fake.created[0]
+	require.Equal(t, "node-v22", created.SourceBranch)
+	require.Equal(t, "main", created.TargetBranch)
+	require.Equal(t, "automated-pr,dependency", created.Labels)
+	require.Equal(t, []int{42}, created.AssigneeIDs)
+	require.Equal(t, []int{43}, created.ReviewerIDs)
+}
+
+func TestGitLabUpdateExistingMergeRequest(t *testing.T) {
+	t.Parallel()
+
+	fake := &fakeGitLab{existing: []gitlabMergeRequest{{ID: 107, IID: 7, State: "opened"}}}
+	server := httptest.NewServer(fake.handler(t))
+	defer server.Close()
+
+	gl := newTestGitLab(t, server.URL)
+	mr, err := gl.CreateOrUpdateChangeRequest(context.Background(), ChangeRequestOptions{
+		Repo:         "es-indexer",
+		SourceBranch: "node-v22",
+		TargetBranch: "main",
+		Title:        "Upgrade node to v22 (again)",
+	})
+	require.NoError(t, err)
+	require.Equal(t, 7, mr.Number)
+
+	require.Empty(t, fake.created)
+	require.Len(t, fake.updated, 1)
+	require.Equal(t, "Upgrade node to v22 (again)", fake.updated[0].Title)
+	require.Empty(t, fake.updated[0].SourceBranch)
+
+	// the labels, assignees and reviewers people added to the merge request are kept
+	require.ElementsMatch(t, []string{"title", "description"}, fake.updatedFields[0])
+}
+
+func TestGitLabUnknownUser(t *testing.T) {
+	t.Parallel()
+
+	fake := &fakeGitLab{}
+	server := httptest.NewServer(fake.handler(t))
+	defer server.Close()
+
+	gl := newTestGitLab(t, server.URL)
+	_, err := gl.CreateOrUpdateChangeRequest(context.Background(), ChangeRequestOptions{
+		Repo:         "es-indexer",
+		SourceBranch: "node-v22",
+		Assignees:    []string{"nobody"},
+	})
+	require.ErrorContains(t, err, `gitlab user "nobody" not found`)
+	require.Empty(t, fake.created)
+}
+
+func TestGitLabGetChangeRequest(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer((&fakeGitLab{}).handler(t))
+	defer server.Close()
+
+	gl := newTestGitLab(t, server.URL)
+	mr, err := gl.GetChangeRequest(context.Background(), "es-indexer", 7)
+	require.NoError(t, err)
+	require.Equal(t, ChangeRequestMerged, mr.State)
+}
+
+func TestGitLabCloneURL(t *testing.T) {
+	t.Parallel()
+
+	gl := newTestGitLab(t, DefaultGitLabAPIURL)
+	require.Equal(t, "https://gitlab.com/backend/es-indexer.git", gl.CloneURL("es-indexer"))
+}
@@ -0,0 +1,108 @@
+package scm
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+
+	"github.com/brightfame/metamorph/internal/config"
+)
+
+// PlatformType is the type of SCM platform.
+type PlatformType string
+
+const (
+	// GitLabPlatformType is the GitLab platform type.
+	GitLabPlatformType PlatformType = "gitlab"
+	// GitHubPlatformType is the GitHub platform type.
+	GitHubPlatformType PlatformType = "github"
+)
+
+// String returns the platform type string.
+func (pt PlatformType) String() string {
+	return string(pt)
+}
+
+// ParsePlatformType parses the given string into a PlatformType.
+func ParsePlatformType(pt string) (PlatformType, error) {
+	switch pt {
+	case GitLabPlatformType.String():
+		return GitLabPlatformType, nil
+	case GitHubPlatformType.String():
+		return GitHubPlatformType, nil
+	default:
+		return "", fmt.Errorf("unknown platform type: %s", pt)
+	}
+}
+
+// ChangeRequestState is the normalized state of a merge request or pull request.
+type ChangeRequestState string
+
+const (
+	ChangeRequestOpen   ChangeRequestState = "open"
+	ChangeRequestClosed ChangeRequestState = "closed"
+	ChangeRequestMerged ChangeRequestState = "merged"
+)
+
+// ChangeRequest is a GitLab merge request or a GitHub pull request.
+type ChangeRequest struct {
+	// Number is the per-repository number of the change request (the IID on GitLab).
+	Number int
+	URL    string
+	State  ChangeRequestState
+}
+
+// ChangeRequestOptions contains the details of a change request to create or update.
+type ChangeRequestOptions struct {
+	// Repo is the name of the repository relative to the platform org, e.g. "backend/es-indexer".
+	Repo         string
+	SourceBranch string
+	TargetBranch string
+	Title        string
+	Description  string
+	Labels       []string
+	// Assignees and Reviewers are platform usernames.
+	Assignees []string
+	Reviewers []string
+}
+
+// Platform interface defines the operations that should be implemented by an SCM platform.
+type Platform interface {
+	// Type returns the type of the platform.
+	Type() PlatformType
+
+	// CloneURL returns the URL used to clone the given repository.
+	CloneURL(repo string) string
+
+	// Auth returns the credentials used to clone and push repositories.
+	Auth() (transport.AuthMethod, error)
+
+	// CABundle returns the additional CA certificates used to verify the platform, if any.
+	CABundle() []byte
+
+	// CreateOrUpdateChangeRequest opens a change request for the source branch, or updates the open change request
+	// if one already exists.
+	CreateOrUpdateChangeRequest(ctx context.Context, opts ChangeRequestOptions) (*ChangeRequest, error)
+
+	// CloseChangeRequest closes the change request without merging it.
+	CloseChangeRequest(ctx context.Context, repo string, number int) error
+
+	// GetChangeRequest fetches the current status of a change request.
+	GetChangeRequest(ctx context.Context, repo string, number int) (*ChangeRequest, error)
+
+	// ListRepos returns the repositories of the platform org that match the query.
+	ListRepos(ctx context.Context, query config.RepoQuery) ([]Repository, error)
+}
+
+// NewPlatform creates a new platform instance using the specified type.
+func NewPlatform(pt PlatformType, cfg *config.Config) (Platform, error) {
+	switch pt {
+	case GitLabPlatformType:
+		return NewGitLab(cfg)
+	case GitHubPlatformType:
+		return NewGitHub(cfg)
+	}
+
+	return nil, fmt.Errorf("unknown SCM platform: %s", pt)
+}
@@ -1,6 +1,7 @@
 package shell
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
@@ -13,15 +14,29 @@ func RunShellCommandAndGetStdout(options *ShellOptions, command string, args ...
 	return out.Stdout(), err
 }
 
+// RunShellCommandContext runs the specified shell command with the specified arguments and streams its output to the
+// logger of the options. It returns the captured stdout and stderr, also when the command fails. The command is
+// killed when ctx is done, in which case the error wraps the context's error. A non-zero exit code results in an
+// *exec.ExitError.
+func RunShellCommandContext(ctx context.Context, options *ShellOptions, command string, args ...string) (*Output, error) {
+	return runShellCommandContext(ctx, options, true, command, args...)
+}
+
 // Run the specified shell command with the specified arguments. Return its stdout and stderr as a string and also
 // stream stdout and stderr to the OS stdout/stderr
 func runShellCommand(options *ShellOptions, streamOutput bool, command string, args ...string) (*Output, error) {
+	return runShellCommandContext(context.Background(), options, streamOutput, command, args...)
+}
+
+func runShellCommandContext(ctx context.Context, options *ShellOptions, streamOutput bool, command string, args ...string) (*Output, error) {
 	logCommand(options, command, args...)
-	cmd := exec.Command(command, args...)
+	cmd := exec.CommandContext(ctx, command, args...)
 
 	setCommandOptions(options, cmd)
 
-	cmd.Stdin = os.Stdin
+	if !options.NonInteractive {
+		cmd.Stdin = os.Stdin
+	}
 
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
@@ -37,17 +52,27 @@ func runShellCommand(options *ShellOptions, streamOutput bool, command string, a
 		return nil, err
 	}
 
+	// processes started by the command may keep the pipes open after it was killed, so stop reading when ctx is done
+	stop := context.AfterFunc(ctx, func() {
+		stdout.Close()
+		stderr.Close()
+	})
+	defer stop()
+
 	output, err := readStdoutAndStderr(
 		options.Logger,
 		streamOutput,
 		stdout,
 		stderr,
 	)
-	if err != nil {
+	if err != nil && ctx.Err() == nil {
 		return output, err
 	}
 
 	err = cmd.Wait()
+	if ctx.Err() != nil {
+		return output, fmt.Errorf("command %s was stopped: %w", command, ctx.Err())
+	}
 	return output, err
 }
 